@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+const (
+	aggregatorPushPath = "/api/v1/push"
+	// aggregatorMaxReports bounds the buffer when the aggregator can't keep
+	// up or its outputs are down; the oldest reports are dropped first.
+	aggregatorMaxReports = 1000
+	// aggregatorMaxBodyBytes bounds a report both as sent and decompressed,
+	// so a misbehaving agent can't exhaust the aggregator's memory.
+	aggregatorMaxBodyBytes = 16 << 20
+)
+
+// Aggregator buffers the cycles agents push until the aggregator's own cycle
+// relabels and writes them for the whole fleet.
+type Aggregator struct {
+	mu      sync.Mutex
+	reports []HistoryRecord
+}
+
+var aggregator = &Aggregator{}
+
+func (a *Aggregator) handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if aggregatorToken != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(aggregatorToken)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(w, r.Body, aggregatorMaxBodyBytes)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer reader.Close()
+		body = http.MaxBytesReader(w, reader, aggregatorMaxBodyBytes)
+	}
+
+	var record HistoryRecord
+	if err := json.NewDecoder(body).Decode(&record); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.mu.Lock()
+	a.reports = append(a.reports, record)
+	if overflow := len(a.reports) - aggregatorMaxReports; overflow > 0 {
+		for _, dropped := range a.reports[:overflow] {
+			observeDroppedSamples("aggregator", len(dropped.Series))
+		}
+		a.reports = a.reports[overflow:]
+	}
+	a.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Aggregator) drain() []HistoryRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	reports := a.reports
+	a.reports = nil
+	return reports
+}
+
+// collectAgentReports turns everything agents pushed since the previous
+// cycle into a cycle of its own. Each sample keeps the time its agent
+// collected it; the agents' instance labels tell the routers apart.
+func collectAgentReports() Cycle {
+	cycle := Cycle{Time: time.Now()}
+	resetCollectorDurations()
+
+	var timeSeriesList []promremote.TimeSeries
+	reports := aggregator.drain()
+	// The buffer is empty after draining; report how far it had filled.
+	observeQueueDepth("aggregator", len(reports))
+	for _, record := range reports {
+		cycle.Interfaces = append(cycle.Interfaces, record.Interfaces...)
+		for _, sample := range record.Series {
+			labels := make([]promremote.Label, 0, len(sample.Labels))
+			for name, value := range sample.Labels {
+				labels = append(labels, promremote.Label{Name: name, Value: value})
+			}
+			// Map order is random; outputs such as Graphite paths need the
+			// same order every cycle.
+			sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+			timeSeriesList = append(timeSeriesList, newTimeSeries(sample.Name, sample.Value, record.Time, labels))
+		}
+	}
+	health.collected(cycle.Time)
+
+	timeSeriesList = append(timeSeriesList, collectSelfMetrics(time.Now())...)
+
+	applyStaticLabels(timeSeriesList, staticLabels)
+	timeSeriesList = relabel(timeSeriesList, relabelRules)
+	alerts.evaluate(timeSeriesList, time.Now())
+
+	cycle.TimeSeries = timeSeriesList
+	collectorLog.Debug("Aggregation finished", "reports", len(reports), "series", len(cycle.TimeSeries), "duration", time.Since(cycle.Time))
+	return cycle
+}
+
+// writeAggregator sends a cycle to the aggregator as gzipped JSON.
+func writeAggregator(cycle Cycle) error {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(writer).Encode(newHistoryRecord(cycle)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(aggregatorURL, "/")+aggregatorPushPath, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	if aggregatorToken != "" {
+		req.Header.Set("Authorization", "Bearer "+aggregatorToken)
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// AlertRule compares every series of a metric against a threshold. Rules
+// are read from a JSON file, for instance
+//
+//	{"name": "offline", "metric": "tether_iface_status_online", "op": "==", "value": 0, "for": "2m"}
+//	{"name": "loss", "metric": "tether_probe_loss_ratio", "op": ">", "value": 0.1}
+//	{"name": "usage", "metric": "tether_iface_period_cap_percent", "op": ">", "value": 90}
+//
+// Matchers restrict a rule to series whose labels fully match the regexes.
+// The message is a text/template over the alert's Rule, Labels and Value.
+// A firing alert is sent again every repeat_interval, if set, and once more
+// when it resolves unless send_resolved is false.
+type AlertRule struct {
+	Name           string            `json:"name"`
+	Metric         string            `json:"metric"`
+	Matchers       map[string]string `json:"matchers"`
+	Op             string            `json:"op"`
+	Value          float64           `json:"value"`
+	For            string            `json:"for"`
+	RepeatInterval string            `json:"repeat_interval"`
+	SendResolved   *bool             `json:"send_resolved"`
+	Severity       string            `json:"severity"`
+	Message        string            `json:"message"`
+
+	forDuration    time.Duration
+	repeatInterval time.Duration
+	matchers       map[string]*regexp.Regexp
+	message        *template.Template
+}
+
+const defaultAlertMessage = `{{.Rule.Name}}: {{.Rule.Metric}}{{if .Labels.interface}} on {{.Labels.interface}}{{end}}{{if .Labels.device}} ({{.Labels.device}}){{end}} is {{.Value}}`
+
+func loadAlertRules(path string) ([]AlertRule, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading alert rules: %w", err)
+	}
+	var rules []AlertRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling alert rules: %w", err)
+	}
+
+	names := make(map[string]bool)
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" || rule.Metric == "" {
+			return nil, fmt.Errorf("alert rule %d: name and metric are required", i)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("alert rule %s: duplicate name", rule.Name)
+		}
+		names[rule.Name] = true
+		switch rule.Op {
+		case "==", "!=", "<", "<=", ">", ">=":
+		default:
+			return nil, fmt.Errorf("alert rule %s: op must be one of == != < <= > >=", rule.Name)
+		}
+		if rule.For != "" {
+			if rule.forDuration, err = time.ParseDuration(rule.For); err != nil {
+				return nil, fmt.Errorf("alert rule %s: invalid for: %w", rule.Name, err)
+			}
+		}
+		if rule.RepeatInterval != "" {
+			if rule.repeatInterval, err = time.ParseDuration(rule.RepeatInterval); err != nil {
+				return nil, fmt.Errorf("alert rule %s: invalid repeat_interval: %w", rule.Name, err)
+			}
+		}
+		if rule.SendResolved == nil {
+			sendResolved := true
+			rule.SendResolved = &sendResolved
+		}
+		if rule.Severity == "" {
+			rule.Severity = "warning"
+		}
+		rule.matchers = make(map[string]*regexp.Regexp)
+		for name, pattern := range rule.Matchers {
+			// Like relabel rules, matchers have to match the whole value.
+			if rule.matchers[name], err = regexp.Compile("^(?:" + pattern + ")$"); err != nil {
+				return nil, fmt.Errorf("alert rule %s: invalid matcher for %s: %w", rule.Name, name, err)
+			}
+		}
+		message := rule.Message
+		if message == "" {
+			message = defaultAlertMessage
+		}
+		if rule.message, err = template.New(rule.Name).Option("missingkey=zero").Parse(message); err != nil {
+			return nil, fmt.Errorf("alert rule %s: invalid message: %w", rule.Name, err)
+		}
+	}
+	return rules, nil
+}
+
+func (r *AlertRule) matches(labels []promremote.Label) bool {
+	if labelValue(labels, "__name__") != r.Metric {
+		return false
+	}
+	for name, regex := range r.matchers {
+		if !regex.MatchString(labelValue(labels, name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *AlertRule) exceeded(value float64) bool {
+	switch r.Op {
+	case "==":
+		return value == r.Value
+	case "!=":
+		return value != r.Value
+	case "<":
+		return value < r.Value
+	case "<=":
+		return value <= r.Value
+	case ">":
+		return value > r.Value
+	case ">=":
+		return value >= r.Value
+	}
+	return false
+}
+
+// Alert is one series for which a rule's condition holds. It is pending
+// until the condition held for the rule's for duration and firing after.
+type Alert struct {
+	Rule       *AlertRule
+	Labels     map[string]string
+	Value      float64
+	Since      time.Time
+	FiredAt    time.Time // zero while pending
+	NotifiedAt time.Time
+}
+
+// event is the notification for an alert in the given status, firing or
+// resolved.
+func (a *Alert) event(status string, now time.Time) Event {
+	event := Event{
+		Kind:      "alert",
+		Alert:     a.Rule.Name,
+		Severity:  a.Rule.Severity,
+		Status:    status,
+		Interface: a.Labels["interface"],
+		Device:    a.Labels["device"],
+		Message:   a.message(),
+		Time:      now,
+	}
+	if status == "resolved" {
+		event.Message = fmt.Sprintf("Resolved after %s: %s", now.Sub(a.FiredAt).Round(time.Second), event.Message)
+	}
+	return event
+}
+
+func (a *Alert) message() string {
+	var buf bytes.Buffer
+	if err := a.Rule.message.Execute(&buf, a); err != nil {
+		return fmt.Sprintf("%s: %v", a.Rule.Name, err)
+	}
+	return buf.String()
+}
+
+// alertKey identifies an alert by its rule and the labels of its series.
+func alertKey(rule string, labels []promremote.Label) string {
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		pairs = append(pairs, label.Name+"="+label.Value)
+	}
+	sort.Strings(pairs)
+	return rule + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// AlertEvaluator evaluates the alert rules against the series of every
+// cycle and tracks the state of each alert. A condition has to hold for the
+// rule's for duration, like in Prometheus, before the alert fires. Only
+// transitions and repeats are sent to the notifiers, not every cycle an
+// alert stays firing.
+type AlertEvaluator struct {
+	rules  []AlertRule
+	active map[string]*Alert
+}
+
+var alerts = &AlertEvaluator{
+	active: make(map[string]*Alert),
+}
+
+func (e *AlertEvaluator) evaluate(timeSeriesList []promremote.TimeSeries, now time.Time) {
+	if len(e.rules) == 0 {
+		return
+	}
+
+	active := make(map[string]*Alert)
+	var firing, resolved []*Alert
+	for i := range e.rules {
+		rule := &e.rules[i]
+		for _, ts := range timeSeriesList {
+			if !rule.matches(ts.Labels) || !rule.exceeded(ts.Datapoint.Value) {
+				continue
+			}
+			key := alertKey(rule.Name, ts.Labels)
+			alert, exists := e.active[key]
+			if !exists {
+				labels := make(map[string]string, len(ts.Labels))
+				for _, label := range ts.Labels {
+					labels[label.Name] = label.Value
+				}
+				alert = &Alert{Rule: rule, Labels: labels, Since: now}
+			}
+			alert.Value = ts.Datapoint.Value
+			active[key] = alert
+
+			if alert.FiredAt.IsZero() {
+				if now.Sub(alert.Since) < rule.forDuration {
+					continue
+				}
+				alert.FiredAt = now
+			}
+			firing = append(firing, alert)
+			if alert.NotifiedAt.IsZero() || (rule.repeatInterval > 0 && now.Sub(alert.NotifiedAt) >= rule.repeatInterval) {
+				alert.NotifiedAt = now
+				notify(alert.event("firing", now))
+			}
+		}
+	}
+
+	// Conditions that cleared start over; firing alerts resolve.
+	for key, alert := range e.active {
+		if _, exists := active[key]; exists || alert.FiredAt.IsZero() {
+			continue
+		}
+		resolved = append(resolved, alert)
+		if *alert.Rule.SendResolved {
+			notify(alert.event("resolved", now))
+		}
+	}
+	e.active = active
+
+	sendAlertmanagerAlerts(firing, resolved, now)
+}
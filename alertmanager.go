@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// alertmanagerAlert is an alert as Alertmanager's v2 API takes it.
+type alertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+}
+
+// toAlertmanager converts an alert, naming it after its rule. The series'
+// labels become the alert's labels, so Alertmanager routes, groups and
+// silences by interface and device like alerts from Prometheus. A firing
+// alert ends a few cycles from now unless it is sent again, which keeps it
+// from staying open forever if the monitor goes away.
+func (a *Alert) toAlertmanager(resolved bool, now time.Time) alertmanagerAlert {
+	labels := make(map[string]string, len(a.Labels)+2)
+	for name, value := range a.Labels {
+		if name != "__name__" && value != "" {
+			labels[name] = value
+		}
+	}
+	labels["alertname"] = a.Rule.Name
+	labels["severity"] = a.Rule.Severity
+
+	endsAt := now.Add(4 * time.Duration(pushIntervalSeconds) * time.Second)
+	if resolved {
+		endsAt = now
+	}
+	return alertmanagerAlert{
+		Labels: labels,
+		Annotations: map[string]string{
+			"summary": a.message(),
+			"value":   strconv.FormatFloat(a.Value, 'g', -1, 64),
+		},
+		StartsAt: a.FiredAt,
+		EndsAt:   endsAt,
+	}
+}
+
+// sendAlertmanagerAlerts posts the firing and just resolved alerts to
+// ALERTMANAGER_URL in the background. Alertmanager expects firing alerts to
+// be sent again periodically, so every firing alert goes out every cycle;
+// Alertmanager itself deduplicates them.
+func sendAlertmanagerAlerts(firing, resolved []*Alert, now time.Time) {
+	if alertmanagerURL == "" || len(firing)+len(resolved) == 0 {
+		return
+	}
+
+	var payload []alertmanagerAlert
+	for _, alert := range firing {
+		payload = append(payload, alert.toAlertmanager(false, now))
+	}
+	for _, alert := range resolved {
+		payload = append(payload, alert.toAlertmanager(true, now))
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		notifierLog.Error("Error marshalling Alertmanager alerts", "err", err)
+		return
+	}
+
+	pendingNotifications.Add(1)
+	go func() {
+		defer pendingNotifications.Done()
+		url := strings.TrimSuffix(alertmanagerURL, "/") + "/api/v2/alerts"
+		if err := postNotification(url, "application/json", body); err != nil {
+			notifierLog.Error("Error sending alerts to Alertmanager", "alerts", len(payload), "err", err)
+		}
+	}()
+}
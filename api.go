@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// interfacesHandler serves GET /api/v1/interfaces: the merged view of the
+// last cycle, one object per interface with its mwan3 status and counters,
+// the throughput since the cycle before and its probe results. Until the
+// first cycle completes it answers 503.
+func interfacesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	snapshot, exists := liveState.latest()
+	if !exists {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "no collection yet"})
+		return
+	}
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// streamKeepalive is how often an idle stream gets a comment, so proxies
+// and browsers don't close it between cycles.
+const streamKeepalive = 30 * time.Second
+
+// streamHandler serves GET /api/v1/stream, a server-sent event stream with
+// one "cycle" event per collection cycle, carrying the same object as
+// /api/v1/interfaces. The last cycle is sent right away.
+func streamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	subscriber := liveState.subscribe()
+	defer liveState.unsubscribe(subscriber)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(snapshot Snapshot) error {
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: cycle\ndata: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	if snapshot, exists := liveState.latest(); exists {
+		if err := send(snapshot); err != nil {
+			return
+		}
+	}
+
+	keepalive := time.NewTicker(streamKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case snapshot := <-subscriber:
+			if err := send(snapshot); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import "syscall"
+
+// bindToDevice returns a dialer Control function that binds sockets to a
+// network device, so probes leave through that tether regardless of the
+// routing policy.
+func bindToDevice(device string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+		if controlErr := c.Control(func(fd uintptr) {
+			err = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, device)
+		}); controlErr != nil {
+			return controlErr
+		}
+		return err
+	}
+}
@@ -1 +1 @@
-env GOOS=linux GOARCH=amd64 go build
\ No newline at end of file
+env GOOS=linux GOARCH=amd64 go build -ldflags "-X main.version=$(git describe --tags --always --dirty)"
\ No newline at end of file
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// requiredCommands lists the external commands the current configuration
+// will run. Optional ones are only missed by the collectors that need them.
+func requiredCommands() (required, optional []string) {
+	if aggregatorMode {
+		// An aggregator only relays what its agents push.
+		return nil, nil
+	}
+	required = []string{"ifdev", "mwan3ifstatus", "ifusb"}
+	if trafficBackend == "ip" {
+		required = append(required, "ip")
+	} else {
+		required = append(required, "ifconfig")
+	}
+	if len(sshTargets) > 0 {
+		// Everything else runs on the routers themselves.
+		return []string{"ssh"}, nil
+	}
+
+	optional = []string{"ubus", "uci", "uqmi", "ideviceinfo"}
+	if trafficBackend != "ip" {
+		// The mwan3 default route check needs ip even without its JSON output.
+		optional = append(optional, "ip")
+	}
+	if len(modemATPorts) > 0 {
+		optional = append(optional, "stty")
+	}
+	if len(adbSerials) > 0 {
+		optional = append(optional, "adb")
+	}
+	if collectClients {
+		optional = append(optional, "nlbw")
+	}
+	if collectWireGuardPeers {
+		optional = append(optional, "wg")
+	}
+	if watchFailoverEvents {
+		optional = append(optional, "logread")
+	}
+	if probeTarget != "" {
+		optional = append(optional, "ping")
+	}
+	if collectGateway {
+		optional = append(optional, "arping", "ndisc6")
+	}
+	if speedtestTool != "" {
+		optional = append(optional, speedtestTool)
+	}
+	if remediationOfflineIntervals > 0 && remediationMethod == "uhubctl" {
+		optional = append(optional, "uhubctl")
+	}
+	if stateChangeHook != "" {
+		optional = append(optional, stateChangeHook)
+	}
+	switch restartAction {
+	case "ifup":
+		optional = append(optional, "ifup")
+	case "mwan3":
+		optional = append(optional, "mwan3")
+	}
+	return required, optional
+}
+
+// check validates the configuration and reports which external commands are
+// available, returning false if the monitor couldn't run.
+func check() bool {
+	ok := true
+	if err := validateParameters(); err != nil {
+		fmt.Printf("config: %v\n", err)
+		ok = false
+	} else {
+		fmt.Println("config: ok")
+	}
+	if _, err := loadRelabelRules(relabelConfigFile); err != nil {
+		fmt.Printf("relabel config: %v\n", err)
+		ok = false
+	}
+	if _, err := loadAlertRules(alertRulesFile); err != nil {
+		fmt.Printf("alert rules: %v\n", err)
+		ok = false
+	}
+
+	required, optional := requiredCommands()
+	for _, command := range required {
+		if path, err := exec.LookPath(command); err == nil {
+			fmt.Printf("%s: %s\n", command, path)
+		} else {
+			fmt.Printf("%s: missing\n", command)
+			ok = false
+		}
+	}
+	for _, command := range optional {
+		if path, err := exec.LookPath(command); err == nil {
+			fmt.Printf("%s: %s\n", command, path)
+		} else {
+			fmt.Printf("%s: missing (optional)\n", command)
+		}
+	}
+	return ok
+}
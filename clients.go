@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+const (
+	dnsmasqLeasesFile = "/tmp/dhcp.leases"
+	arpTableFile      = "/proc/net/arp"
+)
+
+// ClientTraffic is the traffic accounted by nlbwmon for a single LAN client.
+// RX is what the client downloaded and TX what it uploaded.
+type ClientTraffic struct {
+	MAC      string
+	Hostname string
+	RX       int64
+	TX       int64
+}
+
+// getClientTraffic reads the per-client totals of the current nlbwmon
+// accounting period. nlbwmon doesn't record which WAN a flow left through,
+// so the totals cover all uplinks combined; ClientWANTracker splits them.
+func getClientTraffic() ([]ClientTraffic, error) {
+	output, err := executeShellCommand("nlbw", "-c", "json", "-g", "mac")
+	if err != nil {
+		return nil, fmt.Errorf("Error executing nlbw: %w", err)
+	}
+
+	var report struct {
+		Columns []string        `json:"columns"`
+		Data    [][]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(output, &report); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling nlbw output: %w", err)
+	}
+
+	columnIndex := make(map[string]int)
+	for i, column := range report.Columns {
+		columnIndex[column] = i
+	}
+	column := func(row []interface{}, name string) interface{} {
+		if i, exists := columnIndex[name]; exists && i < len(row) {
+			return row[i]
+		}
+		return nil
+	}
+
+	hostnames := readLeaseHostnames()
+
+	var clients []ClientTraffic
+	for _, row := range report.Data {
+		mac, _ := column(row, "mac").(string)
+		rx, _ := column(row, "rx_bytes").(float64)
+		tx, _ := column(row, "tx_bytes").(float64)
+		if mac == "" {
+			continue
+		}
+		clients = append(clients, ClientTraffic{
+			MAC:      mac,
+			Hostname: hostnames[strings.ToLower(mac)],
+			RX:       int64(rx),
+			TX:       int64(tx),
+		})
+	}
+
+	return clients, nil
+}
+
+// readLeaseHostnames maps client MAC addresses to the hostnames they
+// announced in their dnsmasq DHCP lease.
+func readLeaseHostnames() map[string]string {
+	hostnames := make(map[string]string)
+
+	data, err := os.ReadFile(dnsmasqLeasesFile)
+	if err != nil {
+		return hostnames
+	}
+
+	// <expiry> <mac> <ip> <hostname> <client-id>
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[3] == "*" {
+			continue
+		}
+		hostnames[strings.ToLower(fields[1])] = fields[3]
+	}
+	return hostnames
+}
+
+// readClientMACs maps LAN client IP addresses to their MAC addresses from
+// the neighbour table, falling back to the DHCP leases for clients that
+// have aged out of it.
+func readClientMACs() map[string]string {
+	macs := make(map[string]string)
+
+	if data, err := os.ReadFile(dnsmasqLeasesFile); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if fields := strings.Fields(line); len(fields) >= 3 {
+				macs[fields[2]] = strings.ToLower(fields[1])
+			}
+		}
+	}
+
+	// IP address  HW type  Flags  HW address  Mask  Device
+	if data, err := os.ReadFile(arpTableFile); err == nil {
+		for _, line := range strings.Split(string(data), "\n")[1:] {
+			fields := strings.Fields(line)
+			if len(fields) < 4 || fields[3] == "00:00:00:00:00:00" {
+				continue
+			}
+			macs[fields[0]] = strings.ToLower(fields[3])
+		}
+	}
+	return macs
+}
+
+type clientWANKey struct {
+	MAC       string
+	Interface string
+}
+
+// ClientWANTracker accumulates client traffic per mwan3 interface from the
+// byte counters conntrack keeps for each connection, which needs
+// nf_conntrack_acct. Connections are attributed to a client by their source
+// address and to a WAN by their mwan3 mark. Traffic a connection carries
+// after the last poll before it closes is missed, so the totals undercount
+// short-lived connections.
+type ClientWANTracker struct {
+	mu     sync.Mutex
+	flows  map[string]ConntrackFlow
+	totals map[clientWANKey]ClientTraffic
+}
+
+var clientWANTraffic = &ClientWANTracker{
+	flows:  make(map[string]ConntrackFlow),
+	totals: make(map[clientWANKey]ClientTraffic),
+}
+
+// update adds the traffic each connection carried since the previous poll.
+func (t *ClientWANTracker) update(flows []ConntrackFlow, macs map[string]string, interfaces []string, mask uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	seen := make(map[string]ConntrackFlow, len(flows))
+	for _, flow := range flows {
+		if !flow.HasMark {
+			continue
+		}
+		mac := macs[flow.Source]
+		iface := mwan3InterfaceForMark(flow.Mark, mask, interfaces)
+		if mac == "" || iface == "" {
+			continue
+		}
+		seen[flow.Key] = flow
+
+		// A connection seen for the first time, or one whose tuple was
+		// reused since, counts from zero.
+		previous := t.flows[flow.Key]
+		if flow.TX < previous.TX || flow.RX < previous.RX {
+			previous = ConntrackFlow{}
+		}
+		key := clientWANKey{MAC: mac, Interface: iface}
+		total := t.totals[key]
+		total.MAC = mac
+		total.TX += flow.TX - previous.TX
+		total.RX += flow.RX - previous.RX
+		t.totals[key] = total
+	}
+	t.flows = seen
+}
+
+func (t *ClientWANTracker) snapshot() map[clientWANKey]ClientTraffic {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	totals := make(map[clientWANKey]ClientTraffic, len(t.totals))
+	for key, total := range t.totals {
+		totals[key] = total
+	}
+	return totals
+}
+
+// collectClientWANTraffic polls conntrack and returns the per-WAN client
+// totals.
+func collectClientWANTraffic() (map[clientWANKey]ClientTraffic, error) {
+	interfaces, err := getMwan3Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	flows, err := readConntrackFlows()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %w", conntrackTableFile, err)
+	}
+	clientWANTraffic.update(flows, readClientMACs(), interfaces, getMwan3MarkMask())
+	return clientWANTraffic.snapshot(), nil
+}
+
+func collectClientTraffic(now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("clients", time.Now())
+
+	ok := true
+	var timeSeriesList []promremote.TimeSeries
+	hostnames := readLeaseHostnames()
+
+	clients, err := getClientTraffic()
+	if err != nil {
+		collectorLog.Error("Error getting client traffic", "err", err)
+		ok = false
+	}
+	for _, client := range clients {
+		labels := []promremote.Label{
+			{Name: "mac", Value: client.MAC},
+			{Name: "hostname", Value: client.Hostname},
+		}
+		timeSeriesList = append(timeSeriesList,
+			newTimeSeries("tether_client_bytes", float64(client.RX), now, append(labels, promremote.Label{Name: "direction", Value: "rx"})),
+			newTimeSeries("tether_client_bytes", float64(client.TX), now, append(labels, promremote.Label{Name: "direction", Value: "tx"})),
+		)
+	}
+
+	wanTraffic, err := collectClientWANTraffic()
+	if err != nil {
+		collectorLog.Error("Error getting client traffic per WAN", "err", err)
+		return timeSeriesList, false
+	}
+	for key, client := range wanTraffic {
+		labels := []promremote.Label{
+			{Name: "mac", Value: client.MAC},
+			{Name: "hostname", Value: hostnames[client.MAC]},
+			{Name: "interface", Value: key.Interface},
+		}
+		timeSeriesList = append(timeSeriesList,
+			newTimeSeries("tether_client_wan_bytes", float64(client.RX), now, append(labels, promremote.Label{Name: "direction", Value: "rx"})),
+			newTimeSeries("tether_client_wan_bytes", float64(client.TX), now, append(labels, promremote.Label{Name: "direction", Value: "tx"})),
+		)
+	}
+	return timeSeriesList, ok
+}
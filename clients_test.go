@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClientWANTrackerUpdate(t *testing.T) {
+	interfaces := []string{"wan_usb0", "wan_usb1"}
+	macs := map[string]string{"192.168.1.10": "aa:bb:cc:dd:ee:ff"}
+	parse := func(lines ...string) []ConntrackFlow {
+		var flows []ConntrackFlow
+		for _, line := range lines {
+			flows = append(flows, parseConntrackLine(line))
+		}
+		return flows
+	}
+
+	tracker := &ClientWANTracker{
+		flows:  make(map[string]ConntrackFlow),
+		totals: make(map[clientWANKey]ClientTraffic),
+	}
+	tracker.update(parse(
+		"ipv4     2 tcp      6 431999 ESTABLISHED src=192.168.1.10 dst=1.1.1.1 sport=50000 dport=443 packets=10 bytes=1000 src=1.1.1.1 dst=10.0.0.2 sport=443 dport=50000 packets=12 bytes=9000 [ASSURED] mark=256 use=2",
+		"ipv4     2 udp      17 170 src=192.168.1.10 dst=8.8.8.8 sport=40000 dport=53 packets=1 bytes=60 src=8.8.8.8 dst=172.20.10.2 sport=53 dport=40000 packets=1 bytes=120 mark=512 use=1",
+		"ipv4     2 tcp      6 100 ESTABLISHED src=192.168.1.99 dst=1.1.1.1 sport=50001 dport=443 packets=1 bytes=50 src=1.1.1.1 dst=10.0.0.2 sport=443 dport=50001 packets=1 bytes=50 mark=256 use=1",
+	), macs, interfaces, defaultMwan3MarkMask)
+	// The first connection grows, the UDP one closes and another opens.
+	tracker.update(parse(
+		"ipv4     2 tcp      6 431999 ESTABLISHED src=192.168.1.10 dst=1.1.1.1 sport=50000 dport=443 packets=20 bytes=1500 src=1.1.1.1 dst=10.0.0.2 sport=443 dport=50000 packets=30 bytes=20000 [ASSURED] mark=256 use=2",
+		"ipv4     2 tcp      6 431999 ESTABLISHED src=192.168.1.10 dst=9.9.9.9 sport=50002 dport=443 packets=2 bytes=200 src=9.9.9.9 dst=10.0.0.2 sport=443 dport=50002 packets=2 bytes=300 mark=256 use=2",
+	), macs, interfaces, defaultMwan3MarkMask)
+
+	want := map[clientWANKey]ClientTraffic{
+		{MAC: "aa:bb:cc:dd:ee:ff", Interface: "wan_usb0"}: {MAC: "aa:bb:cc:dd:ee:ff", TX: 1700, RX: 20300},
+		{MAC: "aa:bb:cc:dd:ee:ff", Interface: "wan_usb1"}: {MAC: "aa:bb:cc:dd:ee:ff", TX: 60, RX: 120},
+	}
+	if got := tracker.snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+const (
+	conntrackCountFile = "/proc/sys/net/netfilter/nf_conntrack_count"
+	conntrackMaxFile   = "/proc/sys/net/netfilter/nf_conntrack_max"
+	conntrackTableFile = "/proc/net/nf_conntrack"
+)
+
+func readIntFile(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// ConntrackFlow is one tracked connection. TX is what the originating side,
+// for forwarded traffic a LAN client, sent and RX what it received; both are
+// only counted with nf_conntrack_acct enabled.
+type ConntrackFlow struct {
+	Key     string // protocol and original tuple
+	Source  string
+	TX, RX  int64
+	Mark    uint32
+	HasMark bool
+}
+
+// parseConntrackLine reads a line of /proc/net/nf_conntrack, such as
+//
+//	ipv4 2 tcp 6 431999 ESTABLISHED src=192.168.1.10 dst=1.1.1.1 sport=50000 dport=443 packets=10 bytes=1000 src=1.1.1.1 dst=10.0.0.2 sport=443 dport=50000 packets=12 bytes=9000 [ASSURED] mark=256 use=2
+//
+// The first src, dst, sport, dport and bytes belong to the original
+// direction, the second set to the reply.
+func parseConntrackLine(line string) ConntrackFlow {
+	var flow ConntrackFlow
+	fields := strings.Fields(line)
+	var tuple []string
+	if len(fields) > 2 {
+		tuple = append(tuple, fields[2])
+	}
+	var bytesSeen, tupleFields int
+	for _, field := range fields {
+		name, value, found := strings.Cut(field, "=")
+		if !found {
+			continue
+		}
+		switch name {
+		case "src", "dst", "sport", "dport":
+			// Only the original direction identifies the connection.
+			if tupleFields < 4 {
+				tuple = append(tuple, field)
+				if name == "src" {
+					flow.Source = value
+				}
+			}
+			tupleFields++
+		case "bytes":
+			count, _ := strconv.ParseInt(value, 10, 64)
+			if bytesSeen == 0 {
+				flow.TX = count
+			} else {
+				flow.RX = count
+			}
+			bytesSeen++
+		case "mark":
+			if mark, err := strconv.ParseUint(value, 10, 32); err == nil {
+				flow.Mark, flow.HasMark = uint32(mark), true
+			}
+		}
+	}
+	flow.Key = strings.Join(tuple, " ")
+	return flow
+}
+
+// readConntrackFlows reads the connection tracking table.
+func readConntrackFlows() ([]ConntrackFlow, error) {
+	file, err := os.Open(conntrackTableFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var flows []ConntrackFlow
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		flows = append(flows, parseConntrackLine(scanner.Text()))
+	}
+	return flows, scanner.Err()
+}
+
+// countConntrackSessionsByInterface counts tracked connections per mwan3
+// interface using the marks mwan3 attaches to each connection.
+func countConntrackSessionsByInterface() (map[string]int, error) {
+	interfaces, err := getMwan3Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	mask := getMwan3MarkMask()
+
+	flows, err := readConntrackFlows()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, flow := range flows {
+		if !flow.HasMark {
+			continue
+		}
+		if iface := mwan3InterfaceForMark(flow.Mark, mask, interfaces); iface != "" {
+			counts[iface]++
+		}
+	}
+	return counts, nil
+}
+
+func collectConntrack(now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("conntrack", time.Now())
+
+	var timeSeriesList []promremote.TimeSeries
+	ok := true
+
+	if count, err := readIntFile(conntrackCountFile); err == nil {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_conntrack_sessions", float64(count), now, nil))
+	} else {
+		collectorLog.Error("Error reading conntrack count", "err", err)
+		ok = false
+	}
+
+	if maxSessions, err := readIntFile(conntrackMaxFile); err == nil {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_conntrack_sessions_max", float64(maxSessions), now, nil))
+	}
+
+	counts, err := countConntrackSessionsByInterface()
+	if err != nil {
+		collectorLog.Error("Error counting conntrack sessions per interface", "err", err)
+		ok = false
+	}
+	for iface, count := range counts {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_conntrack_interface_sessions", float64(count), now, []promremote.Label{
+			{Name: "interface", Value: iface},
+		}))
+	}
+
+	return timeSeriesList, ok
+}
@@ -0,0 +1,49 @@
+package main
+
+// CounterWrapTracker turns 32-bit interface counters, which wrap at 4 GiB on
+// 32-bit targets, back into cumulative 64-bit values.
+type CounterWrapTracker struct {
+	last   map[string]int64
+	offset map[string]int64
+}
+
+var trafficWraps = &CounterWrapTracker{
+	last:   make(map[string]int64),
+	offset: make(map[string]int64),
+}
+
+// correct returns the cumulative value of a raw counter. A counter that went
+// down from the upper half of the 32-bit range is taken to have wrapped; any
+// other decrease is a reset (reboot, re-plugged device) and starts over.
+func (t *CounterWrapTracker) correct(key string, raw int64) int64 {
+	last, seen := t.last[key]
+	t.last[key] = raw
+	if seen && raw < last {
+		if last >= 1<<31 && last < 1<<32 {
+			t.offset[key] += 1 << 32
+		} else {
+			t.offset[key] = 0
+		}
+	}
+	return raw + t.offset[key]
+}
+
+// apply corrects every counter of every device in place. The prefix keeps
+// the devices of different routers apart.
+func (t *CounterWrapTracker) apply(prefix string, networkTraffic map[string]NetworkTraffic) {
+	for device, traffic := range networkTraffic {
+		for name, counter := range map[string]*int64{
+			"rx":         &traffic.RX,
+			"tx":         &traffic.TX,
+			"rx_packets": &traffic.RXPackets,
+			"tx_packets": &traffic.TXPackets,
+			"rx_errors":  &traffic.RXErrors,
+			"tx_errors":  &traffic.TXErrors,
+			"rx_dropped": &traffic.RXDropped,
+			"tx_dropped": &traffic.TXDropped,
+		} {
+			*counter = t.correct(prefix+device+"/"+name, *counter)
+		}
+		networkTraffic[device] = traffic
+	}
+}
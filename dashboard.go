@@ -0,0 +1,180 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dashboardHistoryCycles is how many cycles the dashboard's sparklines span.
+const dashboardHistoryCycles = 60
+
+// dashboardMetrics are the per-interface series the dashboard shows next to
+// the status and throughput of each interface.
+var dashboardMetrics = []string{
+	"tether_probe_rtt_avg_seconds",
+	"tether_probe_loss_ratio",
+	"tether_gateway_reachable",
+	"tether_phone_battery_percent",
+	"tether_device_temperature_celsius",
+	"tether_modem_signal_rssi_dbm",
+	"tether_modem_signal_rsrp_dbm",
+	"tether_modem_signal_rsrq_db",
+	"tether_modem_signal_sinr_db",
+}
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+// probeMetricPrefixes select the series reported as an interface's probe
+// results.
+var probeMetricPrefixes = []string{"tether_probe_", "tether_dns_probe_", "tether_http_probe_"}
+
+// InterfaceState is an interface as of the last cycle, with the throughput
+// derived from the counters of the cycle before.
+type InterfaceState struct {
+	CombinedData
+	RXRate  float64            `json:"rx_bytes_per_second"`
+	TXRate  float64            `json:"tx_bytes_per_second"`
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+	Probes  map[string]float64 `json:"probes,omitempty"`
+}
+
+// Snapshot is the state of every interface after one cycle.
+type Snapshot struct {
+	Time       time.Time        `json:"time"`
+	Interfaces []InterfaceState `json:"interfaces"`
+}
+
+// LiveState keeps the snapshots of the last cycles for the HTTP endpoints
+// and hands each new one to the clients streaming them.
+type LiveState struct {
+	mu          sync.Mutex
+	snapshots   []Snapshot
+	subscribers map[chan Snapshot]struct{}
+}
+
+var liveState = &LiveState{subscribers: make(map[chan Snapshot]struct{})}
+
+// record turns a cycle into a snapshot. Cycles without interfaces, such as
+// the final one on shutdown, are skipped.
+func (s *LiveState) record(cycle Cycle) {
+	if len(cycle.Interfaces) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := make(map[string]InterfaceState)
+	var elapsed float64
+	if len(s.snapshots) > 0 {
+		last := s.snapshots[len(s.snapshots)-1]
+		elapsed = cycle.Time.Sub(last.Time).Seconds()
+		for _, state := range last.Interfaces {
+			previous[state.Interface] = state
+		}
+	}
+
+	snapshot := Snapshot{Time: cycle.Time}
+	for _, data := range cycle.Interfaces {
+		state := InterfaceState{CombinedData: data, Metrics: make(map[string]float64), Probes: make(map[string]float64)}
+		// Counters that went backwards were reset by a replug.
+		if before, exists := previous[data.Interface]; exists && elapsed > 0 && data.RX >= before.RX && data.TX >= before.TX {
+			state.RXRate = float64(data.RX-before.RX) / elapsed
+			state.TXRate = float64(data.TX-before.TX) / elapsed
+		}
+		snapshot.Interfaces = append(snapshot.Interfaces, state)
+	}
+
+	for _, ts := range cycle.TimeSeries {
+		name := labelValue(ts.Labels, "__name__")
+		iface := labelValue(ts.Labels, "interface")
+		for i := range snapshot.Interfaces {
+			state := &snapshot.Interfaces[i]
+			if state.Interface != iface {
+				continue
+			}
+			// Series split by further labels only show their first.
+			for _, metric := range dashboardMetrics {
+				if _, exists := state.Metrics[metric]; metric == name && !exists {
+					state.Metrics[metric] = ts.Datapoint.Value
+				}
+			}
+			for _, prefix := range probeMetricPrefixes {
+				if _, exists := state.Probes[name]; strings.HasPrefix(name, prefix) && !exists {
+					state.Probes[name] = ts.Datapoint.Value
+				}
+			}
+		}
+	}
+
+	s.snapshots = append(s.snapshots, snapshot)
+	if len(s.snapshots) > dashboardHistoryCycles {
+		s.snapshots = s.snapshots[len(s.snapshots)-dashboardHistoryCycles:]
+	}
+
+	for subscriber := range s.subscribers {
+		// A client that hasn't taken the previous snapshot yet misses this
+		// one rather than holding up the cycle.
+		select {
+		case subscriber <- snapshot:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel receiving the snapshot of every following
+// cycle, until unsubscribe is called with it.
+func (s *LiveState) subscribe() chan Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscriber := make(chan Snapshot, 1)
+	s.subscribers[subscriber] = struct{}{}
+	return subscriber
+}
+
+func (s *LiveState) unsubscribe(subscriber chan Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, subscriber)
+}
+
+// latest returns the snapshot of the last cycle, if there was one.
+func (s *LiveState) latest() (Snapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.snapshots) == 0 {
+		return Snapshot{}, false
+	}
+	return s.snapshots[len(s.snapshots)-1], true
+}
+
+func (s *LiveState) history() []Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Snapshot(nil), s.snapshots...)
+}
+
+// dashboardHandler serves the single-page dashboard. It polls
+// dashboardDataHandler, so it works from a phone on the LAN without any
+// other service.
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardHTML)
+}
+
+func dashboardDataHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"push_interval_seconds": pushIntervalSeconds,
+		"history":               liveState.history(),
+	})
+}
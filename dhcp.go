@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// countActiveLeases counts the unexpired LAN leases handed out by dnsmasq.
+// An expiry of zero marks an infinite lease.
+func countActiveLeases(now time.Time) (int, error) {
+	data, err := os.ReadFile(dnsmasqLeasesFile)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if expiry == 0 || expiry > now.Unix() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func collectLANLeases(now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("dhcp", time.Now())
+
+	count, err := countActiveLeases(now)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			collectorLog.Error("Error reading DHCP leases", "err", err)
+		}
+		return nil, os.IsNotExist(err)
+	}
+	return []promremote.TimeSeries{newTimeSeries("tether_dhcp_leases", float64(count), now, nil)}, true
+}
+
+// collectWANDHCP reports the DHCP state netifd holds for a tether interface.
+// A bound lease disappears once the client fails to renew it, which is the
+// usual symptom of a phone that stopped answering DHCP.
+func collectWANDHCP(iface string, status InterfaceStatus, labels []promremote.Label, now time.Time) []promremote.TimeSeries {
+	if status.Proto != "dhcp" {
+		return nil
+	}
+
+	bound := 0.0
+	if status.Up && len(status.IPv4Addrs) > 0 {
+		bound = 1.0
+	}
+
+	timeSeriesList := []promremote.TimeSeries{newTimeSeries("tether_iface_dhcp_bound", bound, now, labels)}
+	if expiry, ok := dhcpLeaseExpiry(iface, status, now); ok {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_iface_dhcp_lease_expiry_timestamp_seconds", float64(expiry.Unix()), now, labels))
+	}
+	return timeSeriesList
+}
+
+// dhcpEventSlackSeconds is how long before netifd reports the interface up a
+// bound event may be recorded and still belong to the current lease.
+const dhcpEventSlackSeconds = 10
+
+// dhcpEventDir holds a file per netifd interface that udhcpc touches on each
+// bound and renew event, since netifd doesn't record when a lease was last
+// renewed. OpenWrt's udhcpc script sources /etc/udhcpc.user, to which add:
+//
+//	case "$1" in bound|renew)
+//		mkdir -p /var/run/tether-monitor/dhcp
+//		touch "/var/run/tether-monitor/dhcp/$INTERFACE"
+//	esac
+const dhcpEventDir = "/var/run/tether-monitor/dhcp"
+
+// dhcpLeaseExpiry returns when the current lease expires, counting the lease
+// time netifd holds from the last bound or renew event. Without an event
+// since the interface came up the renewal time is unknown and no expiry is
+// reported.
+func dhcpLeaseExpiry(iface string, status InterfaceStatus, now time.Time) (time.Time, bool) {
+	if !status.Up || status.Data.LeaseTime <= 0 {
+		return time.Time{}, false
+	}
+	info, err := os.Stat(filepath.Join(dhcpEventDir, iface))
+	if err != nil {
+		return time.Time{}, false
+	}
+	// Allow for the event landing just before netifd marks the interface up.
+	upSince := now.Add(-time.Duration(status.Uptime+dhcpEventSlackSeconds) * time.Second)
+	if info.ModTime().Before(upSince) {
+		return time.Time{}, false
+	}
+	return info.ModTime().Add(time.Duration(status.Data.LeaseTime) * time.Second), true
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DiscordNotifier posts events to a Discord webhook as embeds colored by
+// severity.
+type DiscordNotifier struct {
+	URL string
+}
+
+func (n DiscordNotifier) Notify(event Event) error {
+	// Discord takes colors as integers rather than hex strings.
+	color, _ := strconv.ParseInt(strings.TrimPrefix(severityColors[eventSeverity(event)], "#"), 16, 32)
+	payload, err := json.Marshal(map[string]any{
+		"embeds": []map[string]any{{
+			"description": event.Message,
+			"color":       color,
+			"fields": []map[string]any{
+				{"name": "Interface", "value": orDash(event.Interface), "inline": true},
+				{"name": "Device", "value": orDash(event.Device), "inline": true},
+			},
+			"timestamp": event.Time.Format(time.RFC3339),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	return postNotification(n.URL, "application/json", payload)
+}
+
+// orDash stands in for empty values, which Discord rejects in embed fields.
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
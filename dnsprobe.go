@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+const dnsProbeTimeout = 5 * time.Second
+
+// resolveVia looks up hostname at a DNS server, sending the query out of
+// device.
+func resolveVia(device, server, hostname string) (time.Duration, error) {
+	dialer := &net.Dialer{Control: bindToDevice(device)}
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, net.JoinHostPort(server, "53"))
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dnsProbeTimeout)
+	defer cancel()
+	start := time.Now()
+	_, err := resolver.LookupHost(ctx, hostname)
+	return time.Since(start), err
+}
+
+// collectDNSProbe resolves DNS_PROBE_HOSTNAME with the DNS servers the
+// carrier handed out for the interface. A tether can pass mwan3's ping
+// tracking while its carrier's resolvers are broken.
+func collectDNSProbe(device string, status InterfaceStatus, labels []promremote.Label, now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("dnsprobe", time.Now())
+
+	var timeSeriesList []promremote.TimeSeries
+	for _, server := range status.DNSServers {
+		serverLabels := append(labels,
+			promremote.Label{Name: "server", Value: server},
+			promremote.Label{Name: "hostname", Value: dnsProbeHostname},
+		)
+		duration, err := resolveVia(device, server, dnsProbeHostname)
+		if err != nil {
+			collectorLog.Debug("DNS probe failed", "device", device, "server", server, "err", err)
+			timeSeriesList = append(timeSeriesList, newTimeSeries("tether_dns_probe_success", 0, now, serverLabels))
+			continue
+		}
+		timeSeriesList = append(timeSeriesList,
+			newTimeSeries("tether_dns_probe_success", 1, now, serverLabels),
+			newTimeSeries("tether_dns_probe_duration_seconds", duration.Seconds(), now, serverLabels),
+		)
+	}
+	return timeSeriesList, true
+}
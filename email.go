@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultEmailSubject = `[tether] {{.Interface}}{{if .Device}} ({{.Device}}){{end}}: {{if .Alert}}{{.Alert}} {{.Status}}{{else if .NewState}}{{.NewState}}{{else}}{{.Kind}}{{end}}`
+	defaultEmailBody    = `{{.Message}}
+
+Interface: {{.Interface}}
+Device:    {{.Device}}
+Time:      {{.Time.Format "2006-01-02 15:04:05 MST"}}
+{{- if .NewState}}
+State:     {{.OldState}} -> {{.NewState}}{{end}}
+{{- if .DowntimeSeconds}}
+Downtime:  {{duration .DowntimeSeconds}}{{end}}
+`
+)
+
+var emailTemplateFuncs = template.FuncMap{
+	"duration": func(seconds float64) string {
+		return (time.Duration(seconds) * time.Second).String()
+	},
+}
+
+// EmailNotifier mails events through an SMTP server. STARTTLS is used
+// whenever the server offers it, and is required for authentication.
+// Port 465 speaks TLS from the start instead. Subject and body are
+// text/templates over the Event.
+type EmailNotifier struct {
+	Address      string // host:port
+	Username     string
+	Password     string
+	PasswordFile string
+	From         string
+	To           []string
+	Subject      *template.Template
+	Body         *template.Template
+}
+
+func newEmailNotifier(address, username, password, passwordFile, from string, to []string, subject, body string) (*EmailNotifier, error) {
+	if subject == "" {
+		subject = defaultEmailSubject
+	}
+	if body == "" {
+		body = defaultEmailBody
+	}
+	subjectTemplate, err := template.New("subject").Funcs(emailTemplateFuncs).Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing SMTP subject template: %w", err)
+	}
+	bodyTemplate, err := template.New("body").Funcs(emailTemplateFuncs).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing SMTP body template: %w", err)
+	}
+	return &EmailNotifier{
+		Address:      address,
+		Username:     username,
+		Password:     password,
+		PasswordFile: passwordFile,
+		From:         from,
+		To:           to,
+		Subject:      subjectTemplate,
+		Body:         bodyTemplate,
+	}, nil
+}
+
+func (n *EmailNotifier) Notify(event Event) error {
+	var subject, body bytes.Buffer
+	if err := n.Subject.Execute(&subject, event); err != nil {
+		return fmt.Errorf("Error executing SMTP subject template: %w", err)
+	}
+	if err := n.Body.Execute(&body, event); err != nil {
+		return fmt.Errorf("Error executing SMTP body template: %w", err)
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", n.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.ReplaceAll(subject.String(), "\n", " ")))
+	fmt.Fprintf(&message, "Date: %s\r\n", event.Time.Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(body.String(), "\n", "\r\n"))
+
+	return n.send(message.Bytes())
+}
+
+func (n *EmailNotifier) send(message []byte) error {
+	host, port, err := net.SplitHostPort(n.Address)
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{ServerName: host}
+
+	dialer := &net.Dialer{Timeout: notifyTimeout}
+	var conn net.Conn
+	if port == "465" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", n.Address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", n.Address)
+	}
+	if err != nil {
+		return fmt.Errorf("Error connecting to SMTP server %s: %w", n.Address, err)
+	}
+	conn.SetDeadline(time.Now().Add(notifyTimeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("Error connecting to SMTP server %s: %w", n.Address, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("Error starting TLS with %s: %w", n.Address, err)
+		}
+	}
+	if n.Username != "" {
+		password, err := resolveSecret(n.Password, n.PasswordFile)
+		if err != nil {
+			return err
+		}
+		// PlainAuth refuses to send credentials without TLS.
+		if err := client.Auth(smtp.PlainAuth("", n.Username, password, host)); err != nil {
+			return fmt.Errorf("Error authenticating with %s: %w", n.Address, err)
+		}
+	}
+
+	if err := client.Mail(n.From); err != nil {
+		return err
+	}
+	for _, to := range n.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+const (
+	mwan3EventRestartDelay = 10 * time.Second
+	logreadTimestampLayout = "Mon Jan _2 15:04:05 2006"
+)
+
+// mwan3's hotplug handler logs every ifup/ifdown it acts on; older releases
+// say "Detect", newer ones "Execute".
+var mwan3EventRegex = regexp.MustCompile(`(?:Detect|Execute) (ifup|ifdown) event on interface (\S+)`)
+
+// FailoverCounters counts the ifup/ifdown events mwan3 handled per interface.
+type FailoverCounters struct {
+	mu             sync.Mutex
+	ifup           map[string]int
+	ifdown         map[string]int
+	lastTransition map[string]time.Time
+}
+
+var failoverCounters = &FailoverCounters{
+	ifup:           make(map[string]int),
+	ifdown:         make(map[string]int),
+	lastTransition: make(map[string]time.Time),
+}
+
+func (c *FailoverCounters) record(action, iface string, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if action == "ifup" {
+		c.ifup[iface]++
+	} else {
+		c.ifdown[iface]++
+	}
+	c.lastTransition[iface] = at
+}
+
+// watchMwan3Events follows the system log for mwan3 events until the process
+// exits, restarting logread whenever it dies.
+func watchMwan3Events() {
+	for {
+		if err := followMwan3Log(); err != nil {
+			collectorLog.Warn("Error following mwan3 log", "err", err)
+		}
+		time.Sleep(mwan3EventRestartDelay)
+	}
+}
+
+// followMwan3Log runs logread itself instead of going through
+// commandRunner, whose Run only returns once the command exited.
+func followMwan3Log() error {
+	cmd := exec.Command("logread", "-f", "-e", "mwan3")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// logread replays the whole ring buffer before following it; skip
+	// anything logged before we started so restarts don't double count.
+	started := time.Now().Truncate(time.Second)
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		matches := mwan3EventRegex.FindStringSubmatch(line)
+		if len(matches) != 3 {
+			continue
+		}
+
+		at := time.Now()
+		if len(line) >= len(logreadTimestampLayout) {
+			if logged, err := time.ParseInLocation(logreadTimestampLayout, line[:len(logreadTimestampLayout)], time.Local); err == nil {
+				if logged.Before(started) {
+					continue
+				}
+				at = logged
+			}
+		}
+		failoverCounters.record(matches[1], matches[2], at)
+	}
+	return cmd.Wait()
+}
+
+func (c *FailoverCounters) collect(now time.Time) []promremote.TimeSeries {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var timeSeriesList []promremote.TimeSeries
+	for iface, at := range c.lastTransition {
+		labels := []promremote.Label{{Name: "interface", Value: iface}}
+		timeSeriesList = append(timeSeriesList,
+			newTimeSeries("tether_mwan3_ifup_total", float64(c.ifup[iface]), now, labels),
+			newTimeSeries("tether_mwan3_ifdown_total", float64(c.ifdown[iface]), now, labels),
+			newTimeSeries("tether_mwan3_last_transition_timestamp_seconds", float64(at.Unix()), now, labels),
+		)
+	}
+	return timeSeriesList
+}
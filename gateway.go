@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+const gatewayProbeTimeoutSeconds = 2
+
+// Busybox and iputils arping both print "... reply from <ip> [<mac>] 0.512ms".
+var arpingReplyRegex = regexp.MustCompile(`reply from \S+ \[[^\]]+\]\s+([\d.]+)\s*ms`)
+
+// resolveGateway checks that the gateway answers address resolution on the
+// device: ARP for IPv4, neighbor solicitation (ndisc6) for IPv6. It returns
+// the time the resolution took.
+func resolveGateway(device, gateway string) (time.Duration, error) {
+	if strings.Contains(gateway, ":") {
+		start := time.Now()
+		output, err := executeShellCommand("ndisc6", "-1", "-r", "1", "-w", strconv.Itoa(gatewayProbeTimeoutSeconds*1000), gateway, device)
+		if err != nil {
+			return 0, fmt.Errorf("Error executing ndisc6 for %s: %w", gateway, err)
+		}
+		if !strings.Contains(string(output), "Target link-layer address") {
+			return 0, fmt.Errorf("no neighbor advertisement from %s", gateway)
+		}
+		return time.Since(start), nil
+	}
+
+	output, err := executeShellCommand("arping", "-I", device, "-c", "1", "-w", strconv.Itoa(gatewayProbeTimeoutSeconds), gateway)
+	// arping exits non-zero without a reply; the output tells.
+	matches := arpingReplyRegex.FindStringSubmatch(string(output))
+	if matches == nil {
+		if err != nil {
+			return 0, fmt.Errorf("Error executing arping for %s: %w", gateway, err)
+		}
+		return 0, fmt.Errorf("no ARP reply from %s", gateway)
+	}
+	return parseMilliseconds(matches[1]), nil
+}
+
+// collectGatewayReachability tells a phone that stopped answering on the
+// USB link apart from a carrier failing further upstream: in the latter
+// case the gateway, which is the phone itself, still resolves.
+func collectGatewayReachability(device string, status InterfaceStatus, labels []promremote.Label, now time.Time) ([]promremote.TimeSeries, bool) {
+	gateway := defaultGateway(status)
+	if gateway == "" {
+		return nil, true
+	}
+	defer observeCollector("gateway", time.Now())
+
+	labels = append(labels, promremote.Label{Name: "gateway", Value: gateway})
+	duration, err := resolveGateway(device, gateway)
+	if err != nil {
+		collectorLog.Debug("Gateway unreachable", "device", device, "gateway", gateway, "err", err)
+		return []promremote.TimeSeries{newTimeSeries("tether_gateway_reachable", 0, now, labels)}, true
+	}
+	return []promremote.TimeSeries{
+		newTimeSeries("tether_gateway_reachable", 1, now, labels),
+		newTimeSeries("tether_gateway_resolution_seconds", duration.Seconds(), now, labels),
+	}, true
+}
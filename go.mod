@@ -1,6 +1,6 @@
 module github.com/leonzdev/tether-router-monitor
 
-go 1.19
+go 1.21
 
 require github.com/m3db/prometheus_remote_client_golang v0.4.4
 
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+const graphiteTimeout = 30 * time.Second
+
+var (
+	graphitePlaceholderRegex = regexp.MustCompile(`\{([^}]+)\}`)
+	graphiteUnsafeRegex      = regexp.MustCompile(`[^A-Za-z0-9_\-:]`)
+)
+
+// graphitePath renders a metric path from the template. {name} is the metric
+// name, {hostname} the router's hostname and any other {label} a label value.
+// Labels the template doesn't mention are appended so paths stay unique.
+func graphitePath(template, hostname string, ts promremote.TimeSeries) string {
+	values := map[string]string{"hostname": hostname}
+	for _, label := range ts.Labels {
+		if label.Name == "__name__" {
+			values["name"] = label.Value
+		} else {
+			values[label.Name] = label.Value
+		}
+	}
+
+	used := make(map[string]bool)
+	path := graphitePlaceholderRegex.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		used[name] = true
+		return graphiteUnsafeRegex.ReplaceAllString(values[name], "_")
+	})
+
+	var segments []string
+	for _, segment := range strings.Split(path, ".") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	for _, label := range ts.Labels {
+		if label.Name != "__name__" && !used[label.Name] && label.Value != "" {
+			segments = append(segments, graphiteUnsafeRegex.ReplaceAllString(label.Value, "_"))
+		}
+	}
+	return strings.Join(segments, ".")
+}
+
+// writeGraphite sends time series to a carbon endpoint using the plaintext
+// protocol.
+func writeGraphite(timeSeriesList []promremote.TimeSeries) error {
+	if len(timeSeriesList) == 0 {
+		return nil
+	}
+
+	hostname, _ := os.Hostname()
+	var buf bytes.Buffer
+	for _, ts := range timeSeriesList {
+		buf.WriteString(graphitePath(graphiteTemplate, hostname, ts))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatFloat(ts.Datapoint.Value, 'f', -1, 64))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatInt(ts.Datapoint.Timestamp.Unix(), 10))
+		buf.WriteByte('\n')
+	}
+
+	conn, err := net.DialTimeout("tcp", graphiteAddress, graphiteTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(graphiteTimeout))
+
+	_, err = conn.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthStaleIntervals is how many push intervals may pass without a
+// successful collection or push before the monitor reports itself unhealthy.
+const healthStaleIntervals = 3
+
+// HealthState records when the monitor last did useful work.
+type HealthState struct {
+	mu             sync.Mutex
+	started        time.Time
+	lastCollection time.Time
+	lastPush       time.Time
+}
+
+var health = &HealthState{started: time.Now()}
+
+func (h *HealthState) collected(at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastCollection = at
+}
+
+func (h *HealthState) pushed(at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastPush = at
+}
+
+// fresh reports whether t is recent enough, allowing a grace period after
+// startup before the first cycle completes.
+func (h *HealthState) fresh(t time.Time, now time.Time) bool {
+	staleAfter := healthStaleIntervals * time.Duration(pushIntervalSeconds) * time.Second
+	if t.IsZero() {
+		return now.Sub(h.started) < staleAfter
+	}
+	return now.Sub(t) < staleAfter
+}
+
+func (h *HealthState) handler(ready bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.mu.Lock()
+		now := time.Now()
+		ok := h.fresh(h.lastCollection, now)
+		if ready {
+			// Ready means data actually leaves the router.
+			ok = ok && !h.lastPush.IsZero() && h.fresh(h.lastPush, now)
+		}
+		response := map[string]interface{}{
+			"status":          "ok",
+			"last_collection": nullableTime(h.lastCollection),
+			"last_push":       nullableTime(h.lastPush),
+		}
+		h.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ok {
+			response["status"] = "unavailable"
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func nullableTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const historyDateLayout = "2006-01-02"
+
+// HistoryRecord is the persisted form of one collection cycle.
+type HistoryRecord struct {
+	Time       time.Time       `json:"time"`
+	Interfaces []CombinedData  `json:"interfaces"`
+	Series     []HistorySample `json:"series"`
+}
+
+// HistorySample is a compact form of a time series datapoint.
+type HistorySample struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+func newHistoryRecord(cycle Cycle) HistoryRecord {
+	record := HistoryRecord{Time: cycle.Time, Interfaces: cycle.Interfaces}
+	for _, ts := range cycle.TimeSeries {
+		sample := HistorySample{Value: ts.Datapoint.Value, Labels: make(map[string]string)}
+		for _, label := range ts.Labels {
+			if label.Name == "__name__" {
+				sample.Name = label.Value
+			} else {
+				sample.Labels[label.Name] = label.Value
+			}
+		}
+		record.Series = append(record.Series, sample)
+	}
+	return record
+}
+
+// appendHistory appends a cycle to the local history store, one JSON record
+// per line in a file per day. Day files make retention a matter of deleting
+// whole files, which keeps writes append-only on the router's flash.
+func appendHistory(cycle Cycle) error {
+	if err := os.MkdirAll(historyDir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(newHistoryRecord(cycle))
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(historyDir, "history-"+cycle.Time.Format(historyDateLayout)+".jsonl")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return pruneHistory(cycle.Time)
+}
+
+// pruneHistory deletes day files that fall entirely outside the retention.
+func pruneHistory(now time.Time) error {
+	matches, err := filepath.Glob(filepath.Join(historyDir, "history-*.jsonl"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+
+	cutoff := now.AddDate(0, 0, -historyRetentionDays)
+	for _, path := range matches {
+		day, err := time.ParseInLocation(historyDateLayout, strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "history-"), ".jsonl"), now.Location())
+		if err != nil {
+			continue
+		}
+		if day.AddDate(0, 0, 1).After(cutoff) {
+			break
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// ExecHookNotifier runs a script on every interface state change, with the
+// details in its environment:
+//
+//	IFACE      mwan3 interface, e.g. wan_usb0
+//	DEVICE     device label
+//	OLD_STATE  online, offline or disabled
+//	NEW_STATE  online, offline or disabled
+//	DURATION   seconds the interface spent in OLD_STATE
+//	MESSAGE    the notification text
+//
+// Other events are ignored. The script gets COMMAND_TIMEOUT_SECONDS to
+// finish, like the commands the collectors run.
+type ExecHookNotifier struct {
+	Path string
+}
+
+func (n ExecHookNotifier) Notify(event Event) error {
+	if event.Kind != "state_change" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, n.Path)
+	killProcessGroupOnCancel(cmd)
+	cmd.WaitDelay = time.Second
+	cmd.Env = append(os.Environ(),
+		"IFACE="+event.Interface,
+		"DEVICE="+event.Device,
+		"OLD_STATE="+event.OldState,
+		"NEW_STATE="+event.NewState,
+		"DURATION="+strconv.FormatInt(int64(event.DurationSeconds), 10),
+		"MESSAGE="+event.Message,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Error executing state change hook %s: %w: %s", n.Path, err, output)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"syscall"
+	"time"
+)
+
+// hotplugSettleDelay gives netifd and mwan3 time to pick up a new device
+// before it is collected; events arriving meanwhile are coalesced.
+const hotplugSettleDelay = 5 * time.Second
+
+// watchHotplug listens for kernel uevents and signals trigger whenever a
+// tether network device is added or removed.
+func watchHotplug(trigger chan<- struct{}) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		collectorLog.Error("Error opening uevent socket", "err", err)
+		return
+	}
+	defer syscall.Close(fd)
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1}); err != nil {
+		collectorLog.Error("Error binding uevent socket", "err", err)
+		return
+	}
+
+	events := make(chan string)
+	go func() {
+		buf := make([]byte, 8192)
+		for {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil {
+				collectorLog.Error("Error reading uevent", "err", err)
+				close(events)
+				return
+			}
+			if device := parseNetUevent(buf[:n]); device != "" {
+				events <- device
+			}
+		}
+	}()
+
+	var settle <-chan time.Time
+	for {
+		select {
+		case device, ok := <-events:
+			if !ok {
+				return
+			}
+			collectorLog.Info("Hotplug event", "device", device)
+			// A different phone may now be behind the same interface name.
+			collectorCache.invalidate("ifusb", device)
+			settle = time.After(hotplugSettleDelay)
+		case <-settle:
+			settle = nil
+			select {
+			case trigger <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// parseNetUevent returns the interface name of a net add/remove uevent for a
+// tether device, or "" for any other event.
+func parseNetUevent(msg []byte) string {
+	var action, subsystem, iface string
+	for _, field := range bytes.Split(msg, []byte{0}) {
+		key, value, found := bytes.Cut(field, []byte("="))
+		if !found {
+			continue
+		}
+		switch string(key) {
+		case "ACTION":
+			action = string(value)
+		case "SUBSYSTEM":
+			subsystem = string(value)
+		case "INTERFACE":
+			iface = string(value)
+		}
+	}
+
+	if subsystem != "net" || (action != "add" && action != "remove") || !isTetherDevice(iface) {
+		return ""
+	}
+	return iface
+}
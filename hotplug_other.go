@@ -0,0 +1,7 @@
+//go:build !linux
+
+package main
+
+func watchHotplug(trigger chan<- struct{}) {
+	collectorLog.Warn("Hotplug detection is only supported on Linux")
+}
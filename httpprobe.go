@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+const httpProbeTimeout = 10 * time.Second
+
+// HTTPProbeResult holds the timings of a single GET. Phases that didn't
+// happen, like the TLS handshake of a plain HTTP URL, stay zero.
+type HTTPProbeResult struct {
+	StatusCode   int
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	TTFB         time.Duration // from sending the request to the first response byte
+}
+
+// probeHTTP fetches url over a fresh connection bound to device. Redirects
+// aren't followed, so the timings cover exactly one request.
+func probeHTTP(device, url string) (HTTPProbeResult, error) {
+	var result HTTPProbeResult
+
+	dialer := &net.Dialer{Timeout: httpProbeTimeout, Control: bindToDevice(device)}
+	client := &http.Client{
+		Timeout: httpProbeTimeout,
+		Transport: &http.Transport{
+			DialContext:       dialer.DialContext,
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var connectStart, tlsStart, requestStart time.Time
+	trace := &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) { connectStart = time.Now() },
+		ConnectDone: func(network, addr string, err error) {
+			result.Connect = time.Since(connectStart)
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			result.TLSHandshake = time.Since(tlsStart)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) { requestStart = time.Now() },
+		GotFirstResponseByte: func() {
+			result.TTFB = time.Since(requestStart)
+		},
+	}
+
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), "GET", url, nil)
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("User-Agent", "tether-router-monitor/"+version)
+	resp, err := client.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	result.StatusCode = resp.StatusCode
+	return result, nil
+}
+
+// collectHTTPProbe probes HTTP_PROBE_URL out of the interface. Carriers that
+// let ICMP through can still throttle or block TCP 443.
+func collectHTTPProbe(device string, labels []promremote.Label, now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("httpprobe", time.Now())
+
+	labels = append(labels, promremote.Label{Name: "url", Value: httpProbeURL})
+
+	result, err := probeHTTP(device, httpProbeURL)
+	if err != nil {
+		collectorLog.Debug("HTTP probe failed", "device", device, "url", httpProbeURL, "err", err)
+		return []promremote.TimeSeries{newTimeSeries("tether_http_probe_success", 0, now, labels)}, true
+	}
+
+	success := 0.0
+	if result.StatusCode < 400 {
+		success = 1.0
+	}
+	timeSeriesList := []promremote.TimeSeries{
+		newTimeSeries("tether_http_probe_success", success, now, labels),
+		newTimeSeries("tether_http_probe_status_code", float64(result.StatusCode), now, labels),
+		newTimeSeries("tether_http_probe_connect_seconds", result.Connect.Seconds(), now, labels),
+		newTimeSeries("tether_http_probe_ttfb_seconds", result.TTFB.Seconds(), now, labels),
+	}
+	if result.TLSHandshake > 0 {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_http_probe_tls_handshake_seconds", result.TLSHandshake.Seconds(), now, labels))
+	}
+	return timeSeriesList, true
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// httpMux serves every HTTP endpoint of the monitor.
+var httpMux = http.NewServeMux()
+
+func startHTTPServer(address string) {
+	httpMux.HandleFunc("/healthz", health.handler(false))
+	httpMux.HandleFunc("/readyz", health.handler(true))
+	httpMux.HandleFunc("/", dashboardHandler)
+	httpMux.HandleFunc("/dashboard/data", dashboardDataHandler)
+	httpMux.HandleFunc("/api/v1/interfaces", interfacesHandler)
+	httpMux.HandleFunc("/api/v1/stream", streamHandler)
+
+	go func() {
+		if err := http.ListenAndServe(address, httpMux); err != nil {
+			logger.Error("Error serving HTTP", "err", err)
+		}
+	}()
+}
+
+// startPprofServer exposes the runtime profiler on its own listener so it
+// can be bound to localhost independently of the health endpoints.
+func startPprofServer(address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			logger.Error("Error serving pprof", "err", err)
+		}
+	}()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+var (
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+)
+
+// toLineProtocol renders time series as InfluxDB line protocol, using the
+// metric name as measurement, the labels as tags and a single "value" field.
+func toLineProtocol(timeSeriesList []promremote.TimeSeries) []byte {
+	var buf bytes.Buffer
+	for _, ts := range timeSeriesList {
+		var name string
+		var tags []string
+		for _, label := range ts.Labels {
+			if label.Name == "__name__" {
+				name = label.Value
+				continue
+			}
+			// Influx rejects empty tag values; an absent tag means the same.
+			if label.Value == "" {
+				continue
+			}
+			tags = append(tags, influxTagEscaper.Replace(label.Name)+"="+influxTagEscaper.Replace(label.Value))
+		}
+		sort.Strings(tags)
+
+		buf.WriteString(influxMeasurementEscaper.Replace(name))
+		for _, tag := range tags {
+			buf.WriteByte(',')
+			buf.WriteString(tag)
+		}
+		buf.WriteString(" value=")
+		buf.WriteString(strconv.FormatFloat(ts.Datapoint.Value, 'g', -1, 64))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatInt(ts.Datapoint.Timestamp.UnixNano()/int64(time.Millisecond), 10))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// writeInflux writes time series to the InfluxDB v2 write API.
+func writeInflux(timeSeriesList []promremote.TimeSeries) error {
+	if len(timeSeriesList) == 0 {
+		return nil
+	}
+
+	query := url.Values{}
+	query.Set("org", influxOrg)
+	query.Set("bucket", influxBucket)
+	query.Set("precision", "ms")
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(influxURL, "/")+"/api/v2/write?"+query.Encode(), bytes.NewReader(toLineProtocol(timeSeriesList)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	token, err := resolveSecret(influxToken, influxTokenFile)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// cachedResult is the last successful result of a collector.
+type cachedResult struct {
+	value any
+	at    time.Time
+}
+
+// CollectorCache holds collector results between their runs, so collectors
+// configured in COLLECTOR_INTERVALS to run less often than every push
+// interval report their last result in the cycles in between. Collection
+// still happens once per push interval, so validateParameters rejects
+// shorter intervals.
+type CollectorCache struct {
+	mu      sync.Mutex
+	results map[string]cachedResult
+}
+
+var collectorCache = &CollectorCache{
+	results: make(map[string]cachedResult),
+}
+
+// cached runs collect if the collector has no interval configured or its
+// result for key is older than the interval, and returns the cached result
+// otherwise. Errors aren't cached, so a failed collector is retried in the
+// next cycle.
+func cached[T any](collector, key string, collect func() (T, error)) (T, error) {
+	interval := time.Duration(collectorIntervals[collector]) * time.Second
+	if interval <= 0 {
+		return collect()
+	}
+
+	cacheKey := collector + "/" + key
+	collectorCache.mu.Lock()
+	result, exists := collectorCache.results[cacheKey]
+	collectorCache.mu.Unlock()
+	if exists && time.Since(result.at) < interval {
+		return result.value.(T), nil
+	}
+
+	value, err := collect()
+	if err == nil {
+		collectorCache.mu.Lock()
+		collectorCache.results[cacheKey] = cachedResult{value: value, at: time.Now()}
+		collectorCache.mu.Unlock()
+	}
+	return value, err
+}
+
+// invalidate drops a cached result so the collector runs again in the next
+// cycle, for instance when its device was replugged.
+func (c *CollectorCache) invalidate(collector, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.results, collector+"/"+key)
+}
+
+// errIncompleteCollection keeps the result of a collector that reported a
+// failure out of the cache.
+var errIncompleteCollection = errors.New("incomplete collection")
+
+// cachedTimeSeries is cached for collectors that return series. Collectors
+// log their own errors and report with ok whether they got everything; the
+// series of a failed run are still exported but not cached, so the collector
+// is retried in the next cycle. Series taken from the cache are stamped with
+// now, like the rest of the cycle.
+func cachedTimeSeries(collector, key string, now time.Time, collect func(now time.Time) ([]promremote.TimeSeries, bool)) []promremote.TimeSeries {
+	timeSeriesList, _ := cached(collector, key, func() ([]promremote.TimeSeries, error) {
+		timeSeriesList, ok := collect(now)
+		if !ok {
+			return timeSeriesList, errIncompleteCollection
+		}
+		return timeSeriesList, nil
+	})
+
+	stamped := make([]promremote.TimeSeries, len(timeSeriesList))
+	for i, timeSeries := range timeSeriesList {
+		timeSeries.Datapoint.Timestamp = now
+		stamped[i] = timeSeries
+	}
+	return stamped
+}
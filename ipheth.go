@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isIPhethDevice reports whether a network interface belongs to an iPhone
+// or iPad tethering over USB, which the kernel drives with ipheth.
+func isIPhethDevice(device string) bool {
+	driver, err := os.Readlink("/sys/class/net/" + device + "/device/driver")
+	return err == nil && filepath.Base(driver) == "ipheth"
+}
+
+// IPhoneInfo is what usbmuxd reports about a connected iOS device.
+type IPhoneInfo struct {
+	Name  string // as set by the owner, e.g. "Leon's iPhone"
+	Model string // product type, e.g. "iPhone14,2"
+}
+
+// getIPhoneInfo asks usbmuxd, through libimobiledevice's ideviceinfo, for the
+// name and model of the iPhone behind an interface. The device is looked up
+// by its UDID, which newer models report as USB serial without the dash.
+// This only works once the phone trusts the router.
+func getIPhoneInfo(ctx context.Context, device string) (IPhoneInfo, error) {
+	udid, err := usbSerial(device)
+	if err != nil {
+		return IPhoneInfo{}, err
+	}
+	if len(udid) == 24 {
+		udid = udid[:8] + "-" + udid[8:]
+	}
+
+	query := func(key string) (string, error) {
+		output, err := executeShellCommandContext(ctx, "ideviceinfo", "-u", udid, "-k", key)
+		if err != nil {
+			return "", fmt.Errorf("Error executing ideviceinfo for %s: %w", udid, err)
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+	var info IPhoneInfo
+	if info.Name, err = query("DeviceName"); err != nil {
+		return IPhoneInfo{}, err
+	}
+	if info.Model, err = query("ProductType"); err != nil {
+		return IPhoneInfo{}, err
+	}
+	return info, nil
+}
+
+// getIPhethDescription describes an iPhone tether by the name its owner gave
+// it and its model, since ifusb only knows the generic model list Apple
+// registers for the product ID, or fails outright on some ipheth devices.
+// Without usbmuxd the USB string descriptors are used instead.
+func getIPhethDescription(ctx context.Context, device string) (string, error) {
+	info, err := getIPhoneInfo(ctx, device)
+	if err == nil && info.Name != "" {
+		return fmt.Sprintf("%s (%s)", info.Name, info.Model), nil
+	}
+	collectorLog.Debug("Error getting iPhone info from usbmuxd", "device", device, "err", err)
+
+	identity, err := getUSBIdentity(device)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(identity.Manufacturer + " " + identity.Product), nil
+}
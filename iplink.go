@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+type ipLinkStats struct {
+	Bytes   int64 `json:"bytes"`
+	Packets int64 `json:"packets"`
+	Errors  int64 `json:"errors"`
+	Dropped int64 `json:"dropped"`
+}
+
+// getIPLinkTraffic reads the interface counters from iproute2's JSON output.
+// It needs the full ip package; BusyBox's ip has no -j.
+func getIPLinkTraffic(ctx context.Context) (map[string]NetworkTraffic, error) {
+	output, err := executeShellCommandContext(ctx, "ip", "-j", "-s", "link")
+	if err != nil {
+		return nil, fmt.Errorf("Error executing ip -j -s link: %w", err)
+	}
+	return parseIPLinkTraffic(output)
+}
+
+func parseIPLinkTraffic(output []byte) (map[string]NetworkTraffic, error) {
+	var links []struct {
+		IfName  string `json:"ifname"`
+		Stats64 struct {
+			RX ipLinkStats `json:"rx"`
+			TX ipLinkStats `json:"tx"`
+		} `json:"stats64"`
+	}
+	if err := json.Unmarshal(output, &links); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling ip link output: %w", err)
+	}
+
+	trafficData := make(map[string]NetworkTraffic)
+	for _, link := range links {
+		rx, tx := link.Stats64.RX, link.Stats64.TX
+		trafficData[link.IfName] = NetworkTraffic{
+			Interface: link.IfName,
+			RX:        rx.Bytes,
+			TX:        tx.Bytes,
+			RXPackets: rx.Packets,
+			TXPackets: tx.Packets,
+			RXErrors:  rx.Errors,
+			TXErrors:  tx.Errors,
+			RXDropped: rx.Dropped,
+			TXDropped: tx.Dropped,
+		}
+	}
+	return trafficData, nil
+}
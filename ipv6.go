@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// ipv6InterfaceStatus returns the netifd interface carrying the IPv6 side
+// of a tether and its status. OpenWrt usually configures DHCPv6 as a
+// separate "<iface>_6" interface; IPV6_INTERFACES overrides the name and
+// interfaces without one are expected to carry IPv6 themselves.
+func ipv6InterfaceStatus(iface string) (string, InterfaceStatus, error) {
+	if v6, exists := ipv6Interfaces[iface]; exists {
+		status, err := getInterfaceStatus(v6)
+		return v6, status, err
+	}
+	if status, err := getInterfaceStatus(iface + "_6"); err == nil {
+		return iface + "_6", status, nil
+	}
+	status, err := getInterfaceStatus(iface)
+	return iface, status, err
+}
+
+// getIPv6Traffic reads the IPv6 byte counters of a device from
+// /proc/net/dev_snmp6, which the kernel keeps per interface.
+func getIPv6Traffic(device string) (rx, tx int64, err error) {
+	data, err := os.ReadFile("/proc/net/dev_snmp6/" + device)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Error reading IPv6 counters of %s: %w", device, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "Ip6InOctets":
+			rx, _ = strconv.ParseInt(fields[1], 10, 64)
+		case "Ip6OutOctets":
+			tx, _ = strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	return rx, tx, nil
+}
+
+// collectIPv6 exports the IPv6 state of a tether: delegated prefixes, the
+// default route learned from router advertisements and the IPv6 share of
+// the traffic.
+func collectIPv6(iface, device string, labels []promremote.Label, now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("ipv6", time.Now())
+
+	var timeSeriesList []promremote.TimeSeries
+	ok := true
+
+	v6, status, err := ipv6InterfaceStatus(iface)
+	if err != nil {
+		collectorLog.Warn("Error getting IPv6 interface status", "interface", iface, "ipv6_interface", v6, "err", err)
+		ok = false
+	} else {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_iface_ipv6_prefixes", float64(len(status.IPv6Prefixes)), now, labels))
+		for _, prefix := range status.IPv6Prefixes {
+			timeSeriesList = append(timeSeriesList, newTimeSeries("tether_iface_ipv6_prefix_valid_seconds", float64(prefix.Valid), now, append(labels,
+				promremote.Label{Name: "prefix", Value: prefix.Address + "/" + strconv.Itoa(prefix.Mask)},
+			)))
+		}
+
+		defaultRoute := 0.0
+		for _, route := range status.Routes {
+			if route.Target != "::" || route.Mask != 0 {
+				continue
+			}
+			defaultRoute = 1.0
+			if route.Valid != nil {
+				timeSeriesList = append(timeSeriesList, newTimeSeries("tether_iface_ipv6_default_route_lifetime_seconds", float64(*route.Valid), now, labels))
+			}
+			break
+		}
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_iface_ipv6_default_route", defaultRoute, now, labels))
+	}
+
+	rx, tx, err := getIPv6Traffic(device)
+	if err != nil {
+		collectorLog.Warn("Error getting IPv6 traffic", "interface", iface, "err", err)
+		ok = false
+	} else {
+		timeSeriesList = append(timeSeriesList,
+			newTimeSeries("tether_iface_ipv6_bytes", float64(rx), now, append(labels, promremote.Label{Name: "direction", Value: "rx"})),
+			newTimeSeries("tether_iface_ipv6_bytes", float64(tx), now, append(labels, promremote.Label{Name: "direction", Value: "tx"})),
+		)
+	}
+	return timeSeriesList, ok
+}
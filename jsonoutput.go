@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// writeJSONLines writes a cycle as a single JSON line to stdout when the
+// output is "-", or appends it to the given file otherwise.
+func writeJSONLines(output string, cycle Cycle) error {
+	data, err := json.Marshal(newHistoryRecord(cycle))
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if output == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	file, err := os.OpenFile(output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(data)
+	return err
+}
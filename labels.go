@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func validateLabelNames(labels map[string]string) error {
+	for name := range labels {
+		if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+	}
+	return nil
+}
+
+// applyStaticLabels adds the configured static labels to every series. A label
+// set by a collector wins over a static label of the same name.
+func applyStaticLabels(timeSeriesList []promremote.TimeSeries, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i := range timeSeriesList {
+		for _, name := range names {
+			if labelValue(timeSeriesList[i].Labels, name) != "" {
+				continue
+			}
+			timeSeriesList[i].Labels = append(timeSeriesList[i].Labels, promremote.Label{Name: name, Value: labels[name]})
+		}
+	}
+}
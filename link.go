@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+const sysClassNet = "/sys/class/net/"
+
+// LinkAttributes are the kernel's view of a network device. mwan3 only
+// reports whether tracking succeeds, which hides carrier flaps and MTU
+// mismatches.
+type LinkAttributes struct {
+	MTU            int64
+	Carrier        int64
+	CarrierChanges int64
+	OperState      string
+	// Speed is in Mbit/s, or -1 when the driver doesn't report one, which
+	// is the case for most USB tethers.
+	Speed int64
+}
+
+func getLinkAttributes(device string) (LinkAttributes, error) {
+	dir := sysClassNet + device + "/"
+	attrs := LinkAttributes{Speed: -1}
+
+	operState, err := os.ReadFile(dir + "operstate")
+	if err != nil {
+		return attrs, err
+	}
+	attrs.OperState = strings.TrimSpace(string(operState))
+
+	// The remaining attributes can't be read while the device is down, so
+	// missing values are left at zero.
+	attrs.MTU, _ = readIntFile(dir + "mtu")
+	attrs.Carrier, _ = readIntFile(dir + "carrier")
+	attrs.CarrierChanges, _ = readIntFile(dir + "carrier_changes")
+	if speed, err := readIntFile(dir + "speed"); err == nil {
+		attrs.Speed = speed
+	}
+	return attrs, nil
+}
+
+func collectLinkAttributes(device string, labels []promremote.Label, now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("link", time.Now())
+
+	attrs, err := getLinkAttributes(device)
+	if err != nil {
+		collectorLog.Error("Error reading link attributes", "device", device, "err", err)
+		return nil, false
+	}
+
+	timeSeriesList := []promremote.TimeSeries{
+		newTimeSeries("tether_iface_mtu", float64(attrs.MTU), now, labels),
+		newTimeSeries("tether_iface_carrier", float64(attrs.Carrier), now, labels),
+		newTimeSeries("tether_iface_carrier_changes_total", float64(attrs.CarrierChanges), now, labels),
+		newTimeSeries("tether_iface_operstate", 1, now, append(labels, promremote.Label{Name: "state", Value: attrs.OperState})),
+	}
+	if attrs.Speed > 0 {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_iface_speed_bits_per_second", float64(attrs.Speed)*1e6, now, labels))
+	}
+	return timeSeriesList, true
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+)
+
+var logLevel = new(slog.LevelVar)
+
+// Component loggers. They start out on the default handler so anything logged
+// before setupLogging still ends up on stderr.
+var (
+	logger         = slog.Default()
+	collectorLog   = logger.With("component", "collector")
+	pusherLog      = logger.With("component", "pusher")
+	notifierLog    = logger.With("component", "notifier")
+	remediationLog = logger.With("component", "remediation")
+)
+
+// setupLogging installs the configured level, format and destination and
+// rebuilds the component loggers on top of the new handler. If syslog can't
+// be reached the logs stay on stderr.
+func setupLogging() {
+	options := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, options)
+	if logFormat == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	}
+
+	var syslogErr error
+	if logSyslog {
+		var syslogHandler slog.Handler
+		syslogHandler, syslogErr = newSyslogHandler(logSyslogFacility, logSyslogTag, logFormat, options)
+		if syslogErr == nil {
+			handler = syslogHandler
+		}
+	}
+
+	logger = slog.New(errorClassHandler{handler})
+	slog.SetDefault(logger)
+
+	collectorLog = logger.With("component", "collector")
+	pusherLog = logger.With("component", "pusher")
+	notifierLog = logger.With("component", "notifier")
+	remediationLog = logger.With("component", "remediation")
+
+	if syslogErr != nil {
+		logger.Warn("Logging to stderr instead of syslog", "err", syslogErr)
+	}
+}
+
+// errorClassHandler tags every record carrying an "err" attribute with a
+// coarse error_class, so log pipelines can group failures without parsing
+// messages.
+type errorClassHandler struct {
+	slog.Handler
+}
+
+func (h errorClassHandler) Handle(ctx context.Context, record slog.Record) error {
+	var class string
+	record.Attrs(func(attr slog.Attr) bool {
+		if err, ok := attr.Value.Any().(error); ok && attr.Key == "err" {
+			class = classifyError(err)
+			return false
+		}
+		return true
+	})
+	if class != "" {
+		record.AddAttrs(slog.String("error_class", class))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h errorClassHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return errorClassHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h errorClassHandler) WithGroup(name string) slog.Handler {
+	return errorClassHandler{h.Handler.WithGroup(name)}
+}
+
+func classifyError(err error) string {
+	var exitErr *exec.ExitError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &exitErr) || errors.Is(err, exec.ErrNotFound):
+		return "exec"
+	case errors.As(err, &syntaxErr) || errors.As(err, &typeErr):
+		return "parse"
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	case errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission):
+		return "filesystem"
+	default:
+		return "other"
+	}
+}
@@ -2,22 +2,43 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"maps"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"os"
-	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/m3db/prometheus_remote_client_golang/promremote"
 )
 
+// dryRun prints each cycle's series instead of writing them anywhere.
+var dryRun bool
+
+// oneShot marks the once command, which exits before background work such
+// as a speedtest could finish.
+var oneShot bool
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
 type Ifdev struct {
 	Interface string `json:"interface"`
 	Device    string `json:"device"`
@@ -32,27 +53,176 @@ type Mwan3ifstatus struct {
 }
 
 type CombinedData struct {
-	Interface  string `json:"interface"`
-	Device     string `json:"device"`
-	Status     string `json:"status"`
-	OnlineTime string `json:"online_time"`
-	Uptime     string `json:"uptime"`
-	Tracking   string `json:"tracking"`
-	RX         int64  `json:"rx"` // Bytes received
-	TX         int64  `json:"tx"` // Bytes sent
+	Interface   string `json:"interface"`
+	Device      string `json:"device"`
+	Description string `json:"description"` // USB device description from ifusb
+	Status      string `json:"status"`
+	OnlineTime  string `json:"online_time"`
+	Uptime      string `json:"uptime"`
+	Tracking    string `json:"tracking"`
+	RX          int64  `json:"rx"` // Bytes received
+	TX          int64  `json:"tx"` // Bytes sent
 }
 
 type NetworkTraffic struct {
 	Interface string
 	RX        int64 // Bytes received
 	TX        int64 // Bytes sent
+	RXPackets int64
+	TXPackets int64
+	RXErrors  int64
+	TXErrors  int64
+	RXDropped int64
+	TXDropped int64
 }
 
 var (
-	pushIntervalSeconds int
-	pushURL             string
-	username            string
-	password            string
+	pushIntervalSeconds         int
+	pushJitterSeconds           int
+	pushMaxSamples              int
+	pushMaxBytes                int
+	pushURL                     string
+	username                    string
+	password                    string
+	passwordFile                string
+	pushTLSCAFile               string
+	pushTLSCertFile             string
+	pushTLSKeyFile              string
+	pushTLSInsecure             bool
+	pushBearerToken             string
+	pushBearerTokenFile         string
+	pushHeaders                 map[string]string
+	staticLabels                map[string]string
+	deviceAliases               map[string]string
+	deviceLabelSource           string
+	includeInterfaces           []string
+	excludeInterfaces           []string
+	wanInterfaces               []string
+	instance                    string
+	relabelConfigFile           string
+	alertRulesFile              string
+	alertmanagerURL             string
+	pushSigV4Region             string
+	pushProxyURL                string
+	pushOAuth2TokenURL          string
+	pushOAuth2ClientID          string
+	pushOAuth2ClientSecret      string
+	pushOAuth2ClientSecretFile  string
+	pushOAuth2Scopes            []string
+	modemATPorts                map[string]string
+	phoneDevices                []string
+	hashSIMIdentifiers          bool
+	simHashKey                  string
+	simHashKeyFile              string
+	collectSMSMessages          bool
+	forwardSMS                  bool
+	ussdQueries                 map[string]string
+	ussdIntervalSeconds         int
+	ussdBalancePattern          string
+	adbSerials                  map[string]string
+	usageStateFile              string
+	usageSaveIntervalSeconds    int
+	billingResetDays            map[string]int
+	dataCaps                    map[string]int64
+	dataCapThresholds           []float64
+	trafficBackend              string
+	commandTimeout              time.Duration
+	commandTimeouts             map[string]int
+	fixturesDir                 string
+	fixturesMutate              bool
+	collectorIntervals          map[string]int
+	aggregatorURL               string
+	aggregatorToken             string
+	aggregatorMode              bool
+	sshTargets                  []string
+	sshIdentityFile             string
+	counterWrap32               bool
+	collectClients              bool
+	collectConntrackSessions    bool
+	collectMwan3PolicyMetrics   bool
+	collectSystem               bool
+	collectIPv6State            bool
+	ipv6Interfaces              map[string]string
+	collectThermal              bool
+	collectWifiStations         bool
+	collectWifiStationSignal    bool
+	collectWireGuardPeers       bool
+	openVPNStatusFiles          []string
+	probeTarget                 string
+	dnsProbeHostname            string
+	httpProbeURL                string
+	collectGateway              bool
+	probeCount                  int
+	probeTimeoutSeconds         int
+	probeInterval               string
+	probeRTTBuckets             []float64
+	speedtestTool               string
+	speedtestServer             string
+	speedtestIntervalSeconds    int
+	speedtestDataBudget         int64
+	speedtestSchedule           *Schedule
+	watchFailoverEvents         bool
+	watchHotplugEvents          bool
+	remediationOfflineIntervals int
+	modemWatchdogFailedProbes   int
+	remediationMethod           string
+	restartAction               string
+	restartOfflineThreshold     time.Duration
+	restartCooldown             time.Duration
+	webhookURLs                 []string
+	slackWebhookURLs            []string
+	discordWebhookURLs          []string
+	ntfyURL                     string
+	ntfyToken                   string
+	ntfyPriorities              map[string]string
+	stateChangeHook             string
+	telegramBotToken            string
+	telegramChatID              string
+	smtpAddress                 string
+	smtpUsername                string
+	smtpPassword                string
+	smtpPasswordFile            string
+	smtpFrom                    string
+	smtpTo                      []string
+	smtpSubjectTemplate         string
+	smtpBodyTemplate            string
+	mqttURL                     string
+	mqttUsername                string
+	mqttPassword                string
+	mqttTopic                   string
+	mqttClientID                string
+	influxURL                   string
+	influxToken                 string
+	influxTokenFile             string
+	influxOrg                   string
+	influxBucket                string
+	otlpEndpoint                string
+	otlpHeaders                 map[string]string
+	graphiteAddress             string
+	graphiteTemplate            string
+	statsdAddress               string
+	statsdPrefix                string
+	statsdTags                  bool
+	historyDir                  string
+	historyRetentionDays        int
+	jsonOutput                  string
+	textfilePath                string
+	pushgatewayURL              string
+	pushgatewayJob              string
+	pushgatewayHeaders          map[string]string
+	httpListenAddress           string
+	pprofListenAddress          string
+	logLevelName                string
+	logFormat                   string
+	logSyslog                   bool
+	logSyslogFacility           string
+	logSyslogTag                string
+
+	usage             *UsageTracker
+	pushTLSConfig     *tls.Config
+	remoteWriteClient promremote.Client
+	relabelRules      []RelabelRule
+	pushOAuth2        *OAuth2TokenSource
 )
 
 func init() {
@@ -60,6 +230,292 @@ func init() {
 	pushURL = os.Getenv("PUSH_URL")
 	username = os.Getenv("PUSH_USERNAME")
 	password = os.Getenv("PUSH_PASSWORD")
+	passwordFile = os.Getenv("PUSH_PASSWORD_FILE")
+	pushTLSCAFile = os.Getenv("PUSH_TLS_CA_FILE")
+	pushTLSCertFile = os.Getenv("PUSH_TLS_CERT_FILE")
+	pushTLSKeyFile = os.Getenv("PUSH_TLS_KEY_FILE")
+	pushTLSInsecure, _ = strconv.ParseBool(os.Getenv("PUSH_TLS_INSECURE_SKIP_VERIFY"))
+	pushBearerToken = os.Getenv("PUSH_BEARER_TOKEN")
+	pushBearerTokenFile = os.Getenv("PUSH_BEARER_TOKEN_FILE")
+	pushHeaders = parseKeyValueList(os.Getenv("PUSH_HEADERS"))
+	staticLabels = parseKeyValueList(os.Getenv("STATIC_LABELS"))
+	deviceAliases = parseKeyValueList(os.Getenv("DEVICE_ALIASES"))
+	deviceLabelSource = os.Getenv("DEVICE_LABEL_SOURCE")
+	if deviceLabelSource == "" {
+		deviceLabelSource = "description"
+	}
+	includeInterfaces = parseList(os.Getenv("INCLUDE_INTERFACES"))
+	if len(includeInterfaces) == 0 {
+		includeInterfaces = []string{"usb*"}
+	}
+	excludeInterfaces = parseList(os.Getenv("EXCLUDE_INTERFACES"))
+	wanInterfaces = parseList(os.Getenv("WAN_INTERFACES"))
+	relabelConfigFile = os.Getenv("RELABEL_CONFIG_FILE")
+	alertRulesFile = os.Getenv("ALERT_RULES_FILE")
+	alertmanagerURL = os.Getenv("ALERTMANAGER_URL")
+	// Every series carries an instance label so several routers can share
+	// one endpoint. It defaults to the router's hostname.
+	instance = os.Getenv("INSTANCE")
+	if instance == "" {
+		instance = staticLabels["instance"]
+	}
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+	staticLabels["instance"] = instance
+	pushSigV4Region = os.Getenv("PUSH_SIGV4_REGION")
+	pushProxyURL = os.Getenv("PUSH_PROXY_URL")
+	pushOAuth2TokenURL = os.Getenv("PUSH_OAUTH2_TOKEN_URL")
+	pushOAuth2ClientID = os.Getenv("PUSH_OAUTH2_CLIENT_ID")
+	pushOAuth2ClientSecret = os.Getenv("PUSH_OAUTH2_CLIENT_SECRET")
+	pushOAuth2ClientSecretFile = os.Getenv("PUSH_OAUTH2_CLIENT_SECRET_FILE")
+	pushOAuth2Scopes = parseList(os.Getenv("PUSH_OAUTH2_SCOPES"))
+	modemATPorts = parseKeyValueList(os.Getenv("MODEM_AT_PORTS"))
+	phoneDevices = parseList(os.Getenv("PHONE_DEVICES"))
+	hashSIMIdentifiers, _ = strconv.ParseBool(os.Getenv("HASH_SIM_IDENTIFIERS"))
+	simHashKey = os.Getenv("SIM_HASH_KEY")
+	simHashKeyFile = os.Getenv("SIM_HASH_KEY_FILE")
+	collectSMSMessages, _ = strconv.ParseBool(os.Getenv("COLLECT_SMS"))
+	forwardSMS, _ = strconv.ParseBool(os.Getenv("FORWARD_SMS"))
+	ussdQueries = parseKeyValueList(os.Getenv("USSD_QUERIES"))
+	ussdIntervalSeconds = 21600
+	if value := os.Getenv("USSD_INTERVAL_SECONDS"); value != "" {
+		ussdIntervalSeconds, _ = strconv.Atoi(value)
+	}
+	ussdBalancePattern = os.Getenv("USSD_BALANCE_REGEX")
+	if ussdBalancePattern == "" {
+		ussdBalancePattern = `(\d+(?:[.,]\d+)?)`
+	}
+	adbSerials = parseKeyValueList(os.Getenv("ADB_SERIALS"))
+	usageStateFile = os.Getenv("USAGE_STATE_FILE")
+	usageSaveIntervalSeconds = 600
+	if value := os.Getenv("USAGE_SAVE_INTERVAL_SECONDS"); value != "" {
+		usageSaveIntervalSeconds, _ = strconv.Atoi(value)
+	}
+	billingResetDays = make(map[string]int)
+	for iface, day := range parseKeyValueList(os.Getenv("BILLING_RESET_DAYS")) {
+		billingResetDays[iface], _ = strconv.Atoi(day)
+	}
+	trafficBackend = os.Getenv("TRAFFIC_BACKEND")
+	if trafficBackend == "" {
+		trafficBackend = "ifconfig"
+	}
+	// 32-bit builds run on 32-bit kernels, whose ifconfig counters wrap.
+	counterWrap32 = strconv.IntSize == 32
+	if value := os.Getenv("COUNTER_WRAP_32BIT"); value != "" {
+		counterWrap32, _ = strconv.ParseBool(value)
+	}
+	aggregatorURL = os.Getenv("AGGREGATOR_URL")
+	aggregatorToken = os.Getenv("AGGREGATOR_TOKEN")
+	aggregatorMode, _ = strconv.ParseBool(os.Getenv("AGGREGATOR_MODE"))
+	pushJitterSeconds, _ = strconv.Atoi(os.Getenv("PUSH_JITTER_SECONDS"))
+	pushMaxSamples = 2000
+	if value, err := strconv.Atoi(os.Getenv("PUSH_MAX_SAMPLES_PER_REQUEST")); err == nil {
+		pushMaxSamples = value
+	}
+	pushMaxBytes, _ = strconv.Atoi(os.Getenv("PUSH_MAX_BYTES_PER_REQUEST"))
+	commandTimeout = 30 * time.Second
+	if seconds, err := strconv.Atoi(os.Getenv("COMMAND_TIMEOUT_SECONDS")); err == nil {
+		commandTimeout = time.Duration(seconds) * time.Second
+	}
+	fixturesDir = os.Getenv("FIXTURES_DIR")
+	fixturesMutate, _ = strconv.ParseBool(os.Getenv("FIXTURES_MUTATE"))
+	commandTimeouts = make(map[string]int)
+	for command, value := range parseKeyValueList(os.Getenv("COMMAND_TIMEOUTS")) {
+		seconds, _ := strconv.Atoi(value)
+		commandTimeouts[command] = seconds
+	}
+	// USB descriptions only change when a device is replugged, which hotplug
+	// events and vanishing interfaces invalidate, so they are cached by default.
+	collectorIntervals = map[string]int{"ifusb": max(300, pushIntervalSeconds)}
+	for collector, value := range parseKeyValueList(os.Getenv("COLLECTOR_INTERVALS")) {
+		seconds, _ := strconv.Atoi(value)
+		collectorIntervals[collector] = seconds
+	}
+	sshTargets = parseList(os.Getenv("SSH_TARGETS"))
+	sshIdentityFile = os.Getenv("SSH_IDENTITY_FILE")
+	collectClients, _ = strconv.ParseBool(os.Getenv("COLLECT_CLIENT_TRAFFIC"))
+	collectConntrackSessions, _ = strconv.ParseBool(os.Getenv("COLLECT_CONNTRACK"))
+	collectMwan3PolicyMetrics, _ = strconv.ParseBool(os.Getenv("COLLECT_MWAN3_POLICIES"))
+	collectIPv6State, _ = strconv.ParseBool(os.Getenv("COLLECT_IPV6"))
+	ipv6Interfaces = parseKeyValueList(os.Getenv("IPV6_INTERFACES"))
+	collectSystem, _ = strconv.ParseBool(os.Getenv("COLLECT_SYSTEM"))
+	collectThermal, _ = strconv.ParseBool(os.Getenv("COLLECT_THERMAL"))
+	collectWifiStations, _ = strconv.ParseBool(os.Getenv("COLLECT_WIFI"))
+	collectWifiStationSignal, _ = strconv.ParseBool(os.Getenv("COLLECT_WIFI_STATION_SIGNAL"))
+	collectWireGuardPeers, _ = strconv.ParseBool(os.Getenv("COLLECT_WIREGUARD"))
+	openVPNStatusFiles = parseList(os.Getenv("OPENVPN_STATUS_FILES"))
+	watchFailoverEvents, _ = strconv.ParseBool(os.Getenv("WATCH_MWAN3_EVENTS"))
+	watchHotplugEvents, _ = strconv.ParseBool(os.Getenv("WATCH_HOTPLUG"))
+	remediationOfflineIntervals, _ = strconv.Atoi(os.Getenv("REMEDIATION_OFFLINE_INTERVALS"))
+	modemWatchdogFailedProbes, _ = strconv.Atoi(os.Getenv("MODEM_WATCHDOG_FAILED_PROBES"))
+	remediationMethod = os.Getenv("REMEDIATION_METHOD")
+	if remediationMethod == "" {
+		remediationMethod = "sysfs"
+	}
+	restartAction = os.Getenv("RESTART_ACTION")
+	restartOfflineSeconds, _ := strconv.Atoi(os.Getenv("RESTART_OFFLINE_SECONDS"))
+	restartOfflineThreshold = time.Duration(restartOfflineSeconds) * time.Second
+	restartCooldown = 10 * time.Minute
+	if value := os.Getenv("RESTART_COOLDOWN_SECONDS"); value != "" {
+		restartCooldownSeconds, _ := strconv.Atoi(value)
+		restartCooldown = time.Duration(restartCooldownSeconds) * time.Second
+	}
+	webhookURLs = parseList(os.Getenv("WEBHOOK_URLS"))
+	slackWebhookURLs = parseList(os.Getenv("SLACK_WEBHOOK_URLS"))
+	discordWebhookURLs = parseList(os.Getenv("DISCORD_WEBHOOK_URLS"))
+	ntfyURL = os.Getenv("NTFY_URL")
+	stateChangeHook = os.Getenv("STATE_CHANGE_HOOK")
+	ntfyToken = os.Getenv("NTFY_TOKEN")
+	ntfyPriorities = parseKeyValueList(os.Getenv("NTFY_PRIORITIES"))
+	telegramBotToken = os.Getenv("TELEGRAM_BOT_TOKEN")
+	telegramChatID = os.Getenv("TELEGRAM_CHAT_ID")
+	smtpAddress = os.Getenv("SMTP_ADDRESS")
+	smtpUsername = os.Getenv("SMTP_USERNAME")
+	smtpPassword = os.Getenv("SMTP_PASSWORD")
+	smtpPasswordFile = os.Getenv("SMTP_PASSWORD_FILE")
+	smtpFrom = os.Getenv("SMTP_FROM")
+	smtpTo = parseList(os.Getenv("SMTP_TO"))
+	smtpSubjectTemplate = os.Getenv("SMTP_SUBJECT_TEMPLATE")
+	smtpBodyTemplate = os.Getenv("SMTP_BODY_TEMPLATE")
+	mqttURL = os.Getenv("MQTT_URL")
+	mqttUsername = os.Getenv("MQTT_USERNAME")
+	mqttPassword = os.Getenv("MQTT_PASSWORD")
+	mqttTopic = os.Getenv("MQTT_TOPIC")
+	// MQTT 3.1.1 brokers only have to accept client IDs of up to 23
+	// alphanumeric characters, so the default is a hash of the hostname.
+	mqttClientID = os.Getenv("MQTT_CLIENT_ID")
+	if mqttClientID == "" {
+		hostname, _ := os.Hostname()
+		mqttClientID = defaultMQTTClientID(hostname)
+	}
+	if mqttTopic == "" {
+		mqttTopic = "tether/{interface}"
+	}
+	influxURL = os.Getenv("INFLUX_URL")
+	influxToken = os.Getenv("INFLUX_TOKEN")
+	influxTokenFile = os.Getenv("INFLUX_TOKEN_FILE")
+	influxOrg = os.Getenv("INFLUX_ORG")
+	influxBucket = os.Getenv("INFLUX_BUCKET")
+	otlpEndpoint = os.Getenv("OTLP_ENDPOINT")
+	otlpHeaders = parseKeyValueList(os.Getenv("OTLP_HEADERS"))
+	graphiteAddress = os.Getenv("GRAPHITE_ADDRESS")
+	graphiteTemplate = os.Getenv("GRAPHITE_TEMPLATE")
+	if graphiteTemplate == "" {
+		graphiteTemplate = "tether.{hostname}.{interface}.{name}"
+	}
+	statsdAddress = os.Getenv("STATSD_ADDRESS")
+	statsdPrefix = os.Getenv("STATSD_PREFIX")
+	if statsdPrefix == "" {
+		statsdPrefix = "tether"
+	}
+	statsdTags, _ = strconv.ParseBool(os.Getenv("STATSD_TAGS"))
+	historyDir = os.Getenv("HISTORY_DIR")
+	historyRetentionDays = 7
+	if value := os.Getenv("HISTORY_RETENTION_DAYS"); value != "" {
+		historyRetentionDays, _ = strconv.Atoi(value)
+	}
+	jsonOutput = os.Getenv("JSON_OUTPUT")
+	textfilePath = os.Getenv("TEXTFILE_PATH")
+	pushgatewayURL = os.Getenv("PUSHGATEWAY_URL")
+	pushgatewayJob = os.Getenv("PUSHGATEWAY_JOB")
+	if pushgatewayJob == "" {
+		pushgatewayJob = "tether_router_monitor"
+	}
+	pushgatewayHeaders = parseKeyValueList(os.Getenv("PUSHGATEWAY_HEADERS"))
+	httpListenAddress = os.Getenv("HTTP_LISTEN_ADDRESS")
+	pprofListenAddress = os.Getenv("PPROF_LISTEN_ADDRESS")
+	logLevelName = os.Getenv("LOG_LEVEL")
+	if logLevelName == "" {
+		logLevelName = "info"
+	}
+	logFormat = os.Getenv("LOG_FORMAT")
+	logSyslog, _ = strconv.ParseBool(os.Getenv("LOG_SYSLOG"))
+	logSyslogFacility = os.Getenv("LOG_SYSLOG_FACILITY")
+	if logSyslogFacility == "" {
+		logSyslogFacility = "daemon"
+	}
+	logSyslogTag = os.Getenv("LOG_SYSLOG_TAG")
+	if logSyslogTag == "" {
+		logSyslogTag = "tether-monitor"
+	}
+	probeTarget = os.Getenv("PROBE_TARGET")
+	dnsProbeHostname = os.Getenv("DNS_PROBE_HOSTNAME")
+	httpProbeURL = os.Getenv("HTTP_PROBE_URL")
+	collectGateway, _ = strconv.ParseBool(os.Getenv("COLLECT_GATEWAY"))
+	probeCount = 3
+	if value := os.Getenv("PROBE_COUNT"); value != "" {
+		probeCount, _ = strconv.Atoi(value)
+	}
+	probeInterval = os.Getenv("PROBE_INTERVAL")
+	probeRTTBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+	if value := os.Getenv("PROBE_RTT_BUCKETS"); value != "" {
+		probeRTTBuckets = nil
+		for _, bucket := range parseList(value) {
+			seconds, err := strconv.ParseFloat(bucket, 64)
+			if err != nil {
+				seconds = -1
+			}
+			probeRTTBuckets = append(probeRTTBuckets, seconds)
+		}
+	}
+	probeTimeoutSeconds = 2
+	if value := os.Getenv("PROBE_TIMEOUT_SECONDS"); value != "" {
+		probeTimeoutSeconds, _ = strconv.Atoi(value)
+	}
+	speedtestTool = os.Getenv("SPEEDTEST_TOOL")
+	speedtestServer = os.Getenv("SPEEDTEST_SERVER")
+	speedtestIntervalSeconds = 86400
+	if value := os.Getenv("SPEEDTEST_INTERVAL_SECONDS"); value != "" {
+		speedtestIntervalSeconds, _ = strconv.Atoi(value)
+	}
+	if value := os.Getenv("SPEEDTEST_DATA_BUDGET"); value != "" {
+		speedtestDataBudget, _ = parseByteSize(value)
+	}
+	if value := os.Getenv("SPEEDTEST_SCHEDULE"); value != "" {
+		speedtestSchedule, _ = parseSchedule(value)
+	}
+	dataCaps = make(map[string]int64)
+	for iface, size := range parseKeyValueList(os.Getenv("DATA_CAPS")) {
+		dataCaps[iface], _ = parseByteSize(size)
+	}
+	dataCapThresholds = []float64{100}
+	if value := os.Getenv("DATA_CAP_THRESHOLDS"); value != "" {
+		dataCapThresholds = nil
+		for _, threshold := range parseList(value) {
+			percent, err := strconv.ParseFloat(strings.TrimSuffix(threshold, "%"), 64)
+			if err != nil {
+				percent = -1
+			}
+			dataCapThresholds = append(dataCapThresholds, percent)
+		}
+		sort.Float64s(dataCapThresholds)
+	}
+}
+
+// parseKeyValueList parses a comma-separated list of key=value pairs,
+// e.g. "usb0=/dev/ttyUSB2,usb1=/dev/ttyUSB5".
+func parseKeyValueList(value string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		key, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || key == "" {
+			continue
+		}
+		result[key] = val
+	}
+	return result
+}
+
+// parseList parses a comma-separated list, skipping empty entries.
+func parseList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
 }
 
 func getBasicAuthHeader(username, password string) string {
@@ -68,32 +524,109 @@ func getBasicAuthHeader(username, password string) string {
 	return "Basic " + encodedAuth
 }
 
+// executeShellCommand runs a command and returns its stdout. A command that
+// outlives its timeout is killed together with any children it spawned, so
+// a hung ifusb or mwan3ifstatus can't stall collection.
 func executeShellCommand(command string, args ...string) ([]byte, error) {
-	cmd := exec.Command(command, args...)
-	return cmd.Output()
+	return executeShellCommandContext(context.Background(), command, args...)
+}
+
+// executeShellCommandContext is executeShellCommand bounded additionally by
+// ctx, such as the deadline of a whole collection cycle.
+func executeShellCommandContext(ctx context.Context, command string, args ...string) ([]byte, error) {
+	timeout := commandTimeout
+	if seconds, exists := commandTimeouts[command]; exists {
+		timeout = time.Duration(seconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	output, err := commandRunner.Run(ctx, command, args...)
+	if err != nil {
+		observeExecFailure(command)
+		if ctx.Err() == context.DeadlineExceeded {
+			return output, fmt.Errorf("%s timed out after %s: %w", command, timeout, ctx.Err())
+		}
+	}
+	return output, err
 }
 
-func filterUSBInterfaces(ifdevData []Ifdev) []Ifdev {
-	var usbInterfaces []Ifdev
+// runConcurrently runs the tasks in parallel and waits for all of them,
+// like an errgroup: the first task to fail cancels the context of the
+// others, and its error is returned. Tasks whose failure the rest can do
+// without return nil and report it otherwise.
+func runConcurrently(ctx context.Context, tasks ...func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task func(ctx context.Context) error) {
+			defer wg.Done()
+			if err := task(ctx); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(task)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// matchesAnyPattern reports whether any of the names matches any of the glob
+// patterns.
+func matchesAnyPattern(patterns []string, names ...string) bool {
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if matched, _ := filepath.Match(pattern, name); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isTetherDevice reports whether a network device is selected by the
+// include/exclude patterns. Only the device name is known here, so patterns
+// written against logical interface names don't apply.
+func isTetherDevice(device string) bool {
+	return matchesAnyPattern(includeInterfaces, device) && !matchesAnyPattern(excludeInterfaces, device)
+}
+
+// filterTetherInterfaces keeps the interfaces whose logical or device name
+// matches an include pattern and no exclude pattern, plus the non-tether WAN
+// members listed in WAN_INTERFACES.
+func filterTetherInterfaces(ifdevData []Ifdev) []Ifdev {
+	var tetherInterfaces []Ifdev
 	for _, item := range ifdevData {
-		if len(item.Device) > 2 && item.Device[:3] == "usb" {
-			usbInterfaces = append(usbInterfaces, item)
+		if matchesAnyPattern(wanInterfaces, item.Interface) ||
+			matchesAnyPattern(includeInterfaces, item.Interface, item.Device) &&
+				!matchesAnyPattern(excludeInterfaces, item.Interface, item.Device) {
+			tetherInterfaces = append(tetherInterfaces, item)
 		}
 	}
-	return usbInterfaces
+	return tetherInterfaces
 }
 
-func getUSBDevice(interfaceName string) (string, error) {
-	ifusbOutput, err := executeShellCommand("ifusb", interfaceName)
+func getUSBDevice(ctx context.Context, interfaceName string) (string, error) {
+	ifusbOutput, err := executeShellCommandContext(ctx, "ifusb", interfaceName)
 	if err != nil {
-		return "", fmt.Errorf("Error executing ifusb for %s: %v", interfaceName, err)
+		return "", fmt.Errorf("Error executing ifusb for %s: %w", interfaceName, err)
 	}
+	return parseUSBDescription(ifusbOutput)
+}
 
+func parseUSBDescription(ifusbOutput []byte) (string, error) {
 	var usbInfo struct {
 		Description string `json:"description"`
 	}
 	if err := json.Unmarshal(ifusbOutput, &usbInfo); err != nil {
-		return "", fmt.Errorf("Error unmarshalling ifusb output: %v", err)
+		return "", fmt.Errorf("Error unmarshalling ifusb output: %w", err)
 	}
 
 	return usbInfo.Description, nil
@@ -125,9 +658,12 @@ func parseUptimeToSeconds(uptime string) float64 {
 	return hours*3600 + minutes*60 + seconds
 }
 
-func getNetworkTraffic() (map[string]NetworkTraffic, error) {
-	cmd := exec.Command("ifconfig") // or use 'ip -s link'
-	output, err := cmd.Output()
+func getNetworkTraffic(ctx context.Context) (map[string]NetworkTraffic, error) {
+	if trafficBackend == "ip" {
+		return getIPLinkTraffic(ctx)
+	}
+
+	output, err := executeShellCommandContext(ctx, "ifconfig")
 	if err != nil {
 		return nil, err
 	}
@@ -135,36 +671,79 @@ func getNetworkTraffic() (map[string]NetworkTraffic, error) {
 	return parseNetworkTraffic(string(output)), nil
 }
 
+// parseNetworkTraffic reads the counters of every interface from ifconfig
+// output. It understands both the BusyBox format
+//
+//	RX packets:1234 errors:0 dropped:0 overruns:0 frame:0
+//	RX bytes:123456 (120.5 KiB)  TX bytes:45678 (44.6 KiB)
+//
+// and the multi-line format of GNU net-tools
+//
+//	RX packets 1234  bytes 123456 (120.5 KiB)
+//	RX errors 0  dropped 0  overruns 0  frame 0
 func parseNetworkTraffic(output string) map[string]NetworkTraffic {
 	trafficData := make(map[string]NetworkTraffic)
 	blocks := strings.Split(output, "\n\n") // Split output into blocks
 
 	rxTxRegex := regexp.MustCompile(`RX bytes:(\d+) .* TX bytes:(\d+)`)
+	packetsRegex := regexp.MustCompile(`([RT]X) packets:(\d+) errors:(\d+) dropped:(\d+)`)
+	netToolsBytesRegex := regexp.MustCompile(`([RT]X) packets (\d+)\s+bytes (\d+)`)
+	netToolsErrorsRegex := regexp.MustCompile(`([RT]X) errors (\d+)\s+dropped (\d+)`)
 	for _, block := range blocks {
 		lines := strings.Split(block, "\n")
 		if len(lines) > 0 {
-			// The first line should contain the interface name
+			// The first line should contain the interface name, followed
+			// by a colon in the net-tools format
 			interfaceLine := lines[0]
 			parts := strings.Fields(interfaceLine)
 			if len(parts) > 0 {
-				currentInterface := parts[0]
+				currentInterface := strings.TrimSuffix(parts[0], ":")
+				traffic := NetworkTraffic{Interface: currentInterface}
+				found := false
 
-				// Search for RX and TX bytes in the remaining lines
+				// Search for the packet and byte counters in the remaining lines
 				for _, line := range lines {
+					if matches := packetsRegex.FindStringSubmatch(line); len(matches) == 5 {
+						packets, _ := strconv.ParseInt(matches[2], 10, 64)
+						errs, _ := strconv.ParseInt(matches[3], 10, 64)
+						dropped, _ := strconv.ParseInt(matches[4], 10, 64)
+						if matches[1] == "RX" {
+							traffic.RXPackets, traffic.RXErrors, traffic.RXDropped = packets, errs, dropped
+						} else {
+							traffic.TXPackets, traffic.TXErrors, traffic.TXDropped = packets, errs, dropped
+						}
+					}
 					if strings.Contains(line, "RX bytes") {
 						matches := rxTxRegex.FindStringSubmatch(line)
 						if len(matches) == 3 {
-							rx, _ := strconv.ParseInt(matches[1], 10, 64)
-							tx, _ := strconv.ParseInt(matches[2], 10, 64)
-							trafficData[currentInterface] = NetworkTraffic{
-								Interface: currentInterface,
-								RX:        rx,
-								TX:        tx,
-							}
-							break // Exit the loop once RX and TX are found
+							traffic.RX, _ = strconv.ParseInt(matches[1], 10, 64)
+							traffic.TX, _ = strconv.ParseInt(matches[2], 10, 64)
+							found = true
+						}
+					}
+					if matches := netToolsBytesRegex.FindStringSubmatch(line); len(matches) == 4 {
+						packets, _ := strconv.ParseInt(matches[2], 10, 64)
+						bytes, _ := strconv.ParseInt(matches[3], 10, 64)
+						if matches[1] == "RX" {
+							traffic.RXPackets, traffic.RX = packets, bytes
+						} else {
+							traffic.TXPackets, traffic.TX = packets, bytes
+							found = true
+						}
+					}
+					if matches := netToolsErrorsRegex.FindStringSubmatch(line); len(matches) == 4 {
+						errs, _ := strconv.ParseInt(matches[2], 10, 64)
+						dropped, _ := strconv.ParseInt(matches[3], 10, 64)
+						if matches[1] == "RX" {
+							traffic.RXErrors, traffic.RXDropped = errs, dropped
+						} else {
+							traffic.TXErrors, traffic.TXDropped = errs, dropped
 						}
 					}
 				}
+				if found {
+					trafficData[currentInterface] = traffic
+				}
 			}
 		}
 	}
@@ -201,204 +780,1006 @@ func mergeData(ifdevData []Ifdev, mwan3Data []Mwan3ifstatus, networkTrafficData
 	return combined
 }
 
-func pushMetrics(timeSeriesList []promremote.TimeSeries) {
+// remoteWriteHeaders returns the headers sent with every remote write request.
+// OAuth2 takes precedence over a static bearer token, which takes precedence
+// over basic auth; static headers such as X-Scope-OrgID are applied last and
+// may override any of them.
+func remoteWriteHeaders() (map[string]string, error) {
+	token, err := resolveSecret(pushBearerToken, pushBearerTokenFile)
+	if err != nil {
+		return nil, err
+	}
+	if pushOAuth2 != nil {
+		if token, err = pushOAuth2.Token(); err != nil {
+			return nil, err
+		}
+	}
+	secret, err := resolveSecret(password, passwordFile)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string)
+	if token != "" {
+		headers["Authorization"] = "Bearer " + token
+	} else if username != "" || secret != "" {
+		headers["Authorization"] = getBasicAuthHeader(username, secret)
+	}
+	for name, value := range pushHeaders {
+		headers[name] = value
+	}
+	return headers, nil
+}
+
+// pushProxy routes the push requests through PUSH_PROXY_URL if it is set
+// and otherwise honors HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+func pushProxy(req *http.Request) (*url.URL, error) {
+	if pushProxyURL != "" {
+		return url.Parse(pushProxyURL)
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// newRemoteWriteClient builds the remote write client once, so its
+// connections are kept alive and reused across intervals.
+func newRemoteWriteClient() (promremote.Client, error) {
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:           pushProxy,
+		TLSClientConfig: pushTLSConfig,
+		MaxIdleConns:    1,
+		IdleConnTimeout: 2 * time.Duration(pushIntervalSeconds) * time.Second,
+	}
+	if pushSigV4Region != "" {
+		transport = SigV4RoundTripper{Region: pushSigV4Region, Next: transport}
+	}
+
 	cfg := promremote.NewConfig(
 		promremote.WriteURLOption(pushURL),
 		promremote.HTTPClientTimeoutOption(60*time.Second),
+		promremote.HTTPClientOption(&http.Client{
+			Timeout:   60 * time.Second,
+			Transport: transport,
+		}),
 	)
 
 	client, err := promremote.NewClient(cfg)
 	if err != nil {
-		log.Println("Error creating remote client:", err)
-		return
+		return nil, fmt.Errorf("Error creating remote client: %w", err)
+	}
+	return client, nil
+}
+
+func pushMetrics(timeSeriesList []promremote.TimeSeries) error {
+	headers, err := remoteWriteHeaders()
+	if err != nil {
+		return err
 	}
 
-	ctx := context.Background()
-	opts := promremote.WriteOptions{
-		Headers: map[string]string{
-			"Authorization": getBasicAuthHeader(username, password),
+	var connectStart time.Time
+	trace := &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) {
+			connectStart = time.Now()
 		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			var connectDuration time.Duration
+			if !info.Reused && !connectStart.IsZero() {
+				connectDuration = time.Since(connectStart)
+			}
+			observeRemoteWriteConnection(info.Reused, connectDuration)
+		},
+	}
+	ctx := httptrace.WithClientTrace(context.Background(), trace)
+	opts := promremote.WriteOptions{
+		Headers: headers,
 	}
 
-	if _, err := client.WriteTimeSeries(ctx, timeSeriesList, opts); err != nil {
-		log.Println("Error writing metrics:", err)
+	batches := splitTimeSeries(timeSeriesList, pushMaxSamples, pushMaxBytes)
+	for i, batch := range batches {
+		if _, err := remoteWriteClient.WriteTimeSeries(ctx, batch, opts); err != nil {
+			if len(batches) > 1 {
+				return fmt.Errorf("batch %d of %d: %w", i+1, len(batches), err)
+			}
+			return err
+		}
 	}
+	return nil
+}
+
+// splitTimeSeries splits the series into batches of at most maxSamples
+// samples and, if maxBytes is set, roughly maxBytes of uncompressed payload,
+// so large routers don't hit the receiver's request size limits.
+func splitTimeSeries(timeSeriesList []promremote.TimeSeries, maxSamples, maxBytes int) [][]promremote.TimeSeries {
+	var batches [][]promremote.TimeSeries
+	start, size := 0, 0
+	for i, timeSeries := range timeSeriesList {
+		seriesSize := timeSeriesSize(timeSeries)
+		if i > start && (i-start >= maxSamples || (maxBytes > 0 && size+seriesSize > maxBytes)) {
+			batches = append(batches, timeSeriesList[start:i])
+			start, size = i, 0
+		}
+		size += seriesSize
+	}
+	if start < len(timeSeriesList) {
+		batches = append(batches, timeSeriesList[start:])
+	}
+	return batches
+}
+
+// timeSeriesSize estimates the protobuf encoding of a series: its label
+// strings plus a few bytes of framing per label and for the sample.
+func timeSeriesSize(timeSeries promremote.TimeSeries) int {
+	size := 24
+	for _, label := range timeSeries.Labels {
+		size += len(label.Name) + len(label.Value) + 6
+	}
+	return size
+}
+
+// alternativeOutputConfigured reports whether any output besides Prometheus
+// remote write is enabled.
+func alternativeOutputConfigured() bool {
+	return pushgatewayURL != "" || influxURL != "" || otlpEndpoint != "" || graphiteAddress != "" || statsdAddress != "" || mqttURL != "" || historyDir != "" || jsonOutput != "" || textfilePath != "" || aggregatorURL != ""
 }
 
 func validateParameters() error {
-	if pushURL == "" {
-		return fmt.Errorf("PUSH_URL environment variable is not set")
+	if err := logLevel.UnmarshalText([]byte(logLevelName)); err != nil {
+		return fmt.Errorf("LOG_LEVEL must be debug, info, warn or error")
+	}
+
+	if logFormat != "" && logFormat != "text" && logFormat != "json" {
+		return fmt.Errorf("LOG_FORMAT must be text or json")
+	}
+
+	if logSyslog {
+		if _, err := parseSyslogFacility(logSyslogFacility); err != nil {
+			return fmt.Errorf("LOG_SYSLOG_FACILITY environment variable is invalid: %w", err)
+		}
+	}
+
+	for _, patterns := range [][]string{includeInterfaces, excludeInterfaces, wanInterfaces} {
+		for _, pattern := range patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid interface pattern %q in INCLUDE_INTERFACES, EXCLUDE_INTERFACES or WAN_INTERFACES environment variable", pattern)
+			}
+		}
+	}
+
+	if err := validateLabelNames(staticLabels); err != nil {
+		return fmt.Errorf("STATIC_LABELS environment variable is invalid: %w", err)
+	}
+
+	if aggregatorMode && httpListenAddress == "" {
+		return fmt.Errorf("AGGREGATOR_MODE requires the HTTP_LISTEN_ADDRESS environment variable")
+	}
+
+	if commandTimeout <= 0 {
+		return fmt.Errorf("COMMAND_TIMEOUT_SECONDS environment variable must be positive")
+	}
+	for command, seconds := range commandTimeouts {
+		if seconds <= 0 {
+			return fmt.Errorf("COMMAND_TIMEOUTS environment variable has an invalid timeout for %s", command)
+		}
+	}
+	for collector, seconds := range collectorIntervals {
+		if seconds <= 0 {
+			return fmt.Errorf("COLLECTOR_INTERVALS environment variable has an invalid interval for %s", collector)
+		}
+		// Collectors run at most once per cycle.
+		if seconds < pushIntervalSeconds {
+			return fmt.Errorf("COLLECTOR_INTERVALS interval for %s is shorter than PUSH_INTERVAL_SECONDS", collector)
+		}
+	}
+
+	if trafficBackend != "ifconfig" && trafficBackend != "ip" {
+		return fmt.Errorf("TRAFFIC_BACKEND must be ifconfig or ip")
+	}
+
+	if pushURL == "" && !alternativeOutputConfigured() && !dryRun {
+		return fmt.Errorf("PUSH_URL environment variable is not set and no other output is configured")
+	}
+
+	if historyDir != "" && historyRetentionDays <= 0 {
+		return fmt.Errorf("HISTORY_RETENTION_DAYS has an invalid value")
+	}
+
+	if pushProxyURL != "" {
+		if proxy, err := url.Parse(pushProxyURL); err != nil || proxy.Host == "" {
+			return fmt.Errorf("PUSH_PROXY_URL has an invalid value")
+		}
+	}
+
+	if hashSIMIdentifiers && simHashKey == "" && simHashKeyFile == "" {
+		return fmt.Errorf("HASH_SIM_IDENTIFIERS requires SIM_HASH_KEY or SIM_HASH_KEY_FILE")
+	}
+	if pushOAuth2TokenURL != "" && pushOAuth2ClientID == "" {
+		return fmt.Errorf("PUSH_OAUTH2_CLIENT_ID environment variable is not set")
+	}
+
+	if influxURL != "" && influxBucket == "" {
+		return fmt.Errorf("INFLUX_BUCKET environment variable is not set")
+	}
+
+	if textfilePath != "" && !strings.HasSuffix(textfilePath, ".prom") {
+		return fmt.Errorf("TEXTFILE_PATH must end in .prom for node_exporter to pick it up")
 	}
 
 	if pushIntervalSeconds <= 0 {
 		return fmt.Errorf("PUSH_INTERVAL_SECONDS environment variable is not set or has an invalid value")
 	}
 
+	if pushJitterSeconds < 0 || pushJitterSeconds >= pushIntervalSeconds {
+		return fmt.Errorf("PUSH_JITTER_SECONDS environment variable must be between 0 and PUSH_INTERVAL_SECONDS")
+	}
+
+	if pushMaxSamples <= 0 || pushMaxBytes < 0 {
+		return fmt.Errorf("PUSH_MAX_SAMPLES_PER_REQUEST and PUSH_MAX_BYTES_PER_REQUEST must be positive")
+	}
+
+	for iface, day := range billingResetDays {
+		if day < 1 || day > 31 {
+			return fmt.Errorf("BILLING_RESET_DAYS has an invalid reset day for %s", iface)
+		}
+	}
+
+	for iface, size := range dataCaps {
+		if size <= 0 {
+			return fmt.Errorf("DATA_CAPS has an invalid cap for %s", iface)
+		}
+	}
+	for _, threshold := range dataCapThresholds {
+		if threshold <= 0 {
+			return fmt.Errorf("DATA_CAP_THRESHOLDS has an invalid threshold")
+		}
+	}
+
+	if probeTarget != "" && (probeCount <= 0 || probeTimeoutSeconds <= 0) {
+		return fmt.Errorf("PROBE_COUNT and PROBE_TIMEOUT_SECONDS must be positive")
+	}
+
+	if speedtestTool != "" {
+		if speedtestTool != "iperf3" && speedtestTool != "speedtest-cli" {
+			return fmt.Errorf("SPEEDTEST_TOOL must be iperf3 or speedtest-cli")
+		}
+		if speedtestTool == "iperf3" && speedtestServer == "" {
+			return fmt.Errorf("SPEEDTEST_SERVER environment variable is not set")
+		}
+		if speedtestIntervalSeconds <= 0 {
+			return fmt.Errorf("SPEEDTEST_INTERVAL_SECONDS has an invalid value")
+		}
+		if os.Getenv("SPEEDTEST_DATA_BUDGET") != "" && speedtestDataBudget <= 0 {
+			return fmt.Errorf("SPEEDTEST_DATA_BUDGET has an invalid value")
+		}
+		if value := os.Getenv("SPEEDTEST_SCHEDULE"); value != "" {
+			if _, err := parseSchedule(value); err != nil {
+				return fmt.Errorf("SPEEDTEST_SCHEDULE has an invalid value: %w", err)
+			}
+			if speedtestSchedule.next(time.Now()).IsZero() {
+				return fmt.Errorf("SPEEDTEST_SCHEDULE never matches")
+			}
+		}
+	}
+
+	if httpProbeURL != "" {
+		if probeURL, err := url.Parse(httpProbeURL); err != nil || (probeURL.Scheme != "http" && probeURL.Scheme != "https") {
+			return fmt.Errorf("HTTP_PROBE_URL must be an http or https URL")
+		}
+	}
+
+	if mqttURL != "" && len(mqttClientID) > 23 {
+		return fmt.Errorf("MQTT_CLIENT_ID must be at most 23 bytes")
+	}
+
+	if usageSaveIntervalSeconds <= 0 {
+		return fmt.Errorf("USAGE_SAVE_INTERVAL_SECONDS has an invalid value")
+	}
+
+	if ussdIntervalSeconds <= 0 {
+		return fmt.Errorf("USSD_INTERVAL_SECONDS has an invalid value")
+	}
+	if regex, err := regexp.Compile(ussdBalancePattern); err != nil || regex.NumSubexp() < 1 {
+		return fmt.Errorf("USSD_BALANCE_REGEX must be a valid regular expression with a capture group")
+	}
+
+	for i, bucket := range probeRTTBuckets {
+		if bucket <= 0 || (i > 0 && bucket <= probeRTTBuckets[i-1]) {
+			return fmt.Errorf("PROBE_RTT_BUCKETS must be positive and increasing")
+		}
+	}
+
+	if modemWatchdogFailedProbes < 0 || (modemWatchdogFailedProbes > 0 && probeTarget == "") {
+		return fmt.Errorf("MODEM_WATCHDOG_FAILED_PROBES must be positive and requires PROBE_TARGET")
+	}
+
+	if deviceLabelSource != "description" && deviceLabelSource != "port" {
+		return fmt.Errorf("DEVICE_LABEL_SOURCE must be description or port")
+	}
+
+	if remediationMethod != "sysfs" && remediationMethod != "uhubctl" {
+		return fmt.Errorf("REMEDIATION_METHOD must be sysfs or uhubctl")
+	}
+
+	if restartAction != "" {
+		if restartAction != "ifup" && restartAction != "mwan3" {
+			return fmt.Errorf("RESTART_ACTION must be ifup or mwan3")
+		}
+		if restartOfflineThreshold <= 0 {
+			return fmt.Errorf("RESTART_OFFLINE_SECONDS environment variable is not set or has an invalid value")
+		}
+	}
+
+	if alertmanagerURL != "" {
+		if amURL, err := url.Parse(alertmanagerURL); err != nil || (amURL.Scheme != "http" && amURL.Scheme != "https") {
+			return fmt.Errorf("ALERTMANAGER_URL must be an http or https URL")
+		}
+		if alertRulesFile == "" {
+			return fmt.Errorf("ALERTMANAGER_URL requires ALERT_RULES_FILE")
+		}
+	}
+
+	if (telegramBotToken == "") != (telegramChatID == "") {
+		return fmt.Errorf("TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID must be set together")
+	}
+
+	if ntfyURL != "" {
+		if topicURL, err := url.Parse(ntfyURL); err != nil || (topicURL.Scheme != "http" && topicURL.Scheme != "https") || strings.Trim(topicURL.Path, "/") == "" {
+			return fmt.Errorf("NTFY_URL must be the http or https URL of a topic")
+		}
+	}
+	for severity, priority := range ntfyPriorities {
+		if value, err := strconv.Atoi(priority); err != nil || value < 1 || value > 5 {
+			return fmt.Errorf("NTFY_PRIORITIES has an invalid priority for %s", severity)
+		}
+	}
+
+	if smtpAddress != "" {
+		if _, _, err := net.SplitHostPort(smtpAddress); err != nil {
+			return fmt.Errorf("SMTP_ADDRESS must be host:port")
+		}
+		if smtpFrom == "" || len(smtpTo) == 0 {
+			return fmt.Errorf("SMTP_ADDRESS requires SMTP_FROM and SMTP_TO")
+		}
+		if _, err := newEmailNotifier(smtpAddress, smtpUsername, smtpPassword, smtpPasswordFile, smtpFrom, smtpTo, smtpSubjectTemplate, smtpBodyTemplate); err != nil {
+			return err
+		}
+	}
+
 	// Additional validations can be added here if needed
 
 	return nil
 }
 
-func main() {
-	if err := validateParameters(); err != nil {
-		log.Fatalf("Parameter validation failed: %s", err)
+func newTimeSeries(name string, value float64, timestamp time.Time, labels []promremote.Label) promremote.TimeSeries {
+	return promremote.TimeSeries{
+		Labels: append([]promremote.Label{{Name: "__name__", Value: name}}, labels...),
+		Datapoint: promremote.Datapoint{
+			Timestamp: timestamp,
+			Value:     value,
+		},
 	}
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+}
 
-	ticker := time.NewTicker(time.Duration(pushIntervalSeconds) * time.Second)
-	defer ticker.Stop()
+func labelValue(labels []promremote.Label, name string) string {
+	for _, label := range labels {
+		if label.Name == name {
+			return label.Value
+		}
+	}
+	return ""
+}
 
-loop:
-	for {
-		select {
-		case <-ticker.C:
-			ifdevOutput, err := executeShellCommand("ifdev")
-			if err != nil {
-				log.Println("Error executing ifdev:", err)
-				break
-			}
+// Cycle is the result of one collection pass.
+type Cycle struct {
+	Time       time.Time
+	Interfaces []CombinedData
+	TimeSeries []promremote.TimeSeries
+}
 
-			mwan3ifstatusOutput, err := executeShellCommand("mwan3ifstatus")
-			if err != nil {
-				log.Println("Error executing mwan3ifstatus:", err)
-				break
+func collect() Cycle {
+	if aggregatorMode {
+		return collectAgentReports()
+	}
+	if len(sshTargets) > 0 {
+		return collectSSHTargets()
+	}
+
+	cycle := Cycle{Time: time.Now()}
+	resetCollectorDurations()
+
+	// The base commands and then the ifusb lookups run concurrently under
+	// one deadline, so a slow command can't push a cycle into the next one.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(pushIntervalSeconds)*time.Second)
+	defer cancel()
+
+	// Without ifdev or mwan3ifstatus there is nothing to report, so either
+	// failing stops the others; the traffic counters are optional.
+	var ifdevOutput, mwan3ifstatusOutput []byte
+	var networkTraffic map[string]NetworkTraffic
+	var trafficErr error
+	err := runConcurrently(ctx,
+		func(ctx context.Context) error {
+			defer observeCollector("ifdev", time.Now())
+			var err error
+			if ifdevOutput, err = executeShellCommandContext(ctx, "ifdev"); err != nil {
+				return fmt.Errorf("Error executing ifdev: %w", err)
 			}
-			networkTraffic, err := getNetworkTraffic()
-			if err != nil {
-				log.Println("Error getting network traffic:", err)
+			return nil
+		},
+		func(ctx context.Context) error {
+			defer observeCollector("mwan3ifstatus", time.Now())
+			var err error
+			if mwan3ifstatusOutput, err = executeShellCommandContext(ctx, "mwan3ifstatus"); err != nil {
+				return fmt.Errorf("Error executing mwan3ifstatus: %w", err)
 			}
-			var ifdevData []Ifdev
-			var mwan3ifstatusData []Mwan3ifstatus
+			return nil
+		},
+		func(ctx context.Context) error {
+			defer observeCollector("traffic", time.Now())
+			networkTraffic, trafficErr = cached("traffic", "", func() (map[string]NetworkTraffic, error) {
+				return getNetworkTraffic(ctx)
+			})
+			return nil
+		},
+	)
+	if err != nil {
+		collectorLog.Error("Error collecting interfaces", "err", err)
+		return cycle
+	}
+	if trafficErr != nil {
+		collectorLog.Error("Error getting network traffic", "err", trafficErr)
+	}
+	if counterWrap32 {
+		// The map may be cached for later cycles, so only correct a copy.
+		networkTraffic = maps.Clone(networkTraffic)
+		trafficWraps.apply("", networkTraffic)
+	}
+	var ifdevData []Ifdev
+	var mwan3ifstatusData []Mwan3ifstatus
+
+	json.Unmarshal(ifdevOutput, &ifdevData)
+	json.Unmarshal(mwan3ifstatusOutput, &mwan3ifstatusData)
 
-			json.Unmarshal(ifdevOutput, &ifdevData)
-			json.Unmarshal(mwan3ifstatusOutput, &mwan3ifstatusData)
+	ifdevData = filterTetherInterfaces(ifdevData)
+	health.collected(cycle.Time)
 
-			ifdevData = filterUSBInterfaces(ifdevData)
+	combinedData := mergeData(ifdevData, mwan3ifstatusData, networkTraffic)
 
-			var timeSeriesList []promremote.TimeSeries
-			combinedData := mergeData(ifdevData, mwan3ifstatusData, networkTraffic)
-			for _, data := range combinedData {
-				device, err := getUSBDevice(data.Device)
-				if err != nil {
-					log.Printf("Error getting USB device for interface %s: %v", data.Interface, err)
-					continue
+	// Primary WAN members opted in for comparison have no USB device to
+	// describe, so they are labelled with their device name.
+	descriptions := make([]string, len(combinedData))
+	descriptionErrs := make([]error, len(combinedData))
+	var lookups []func(ctx context.Context) error
+	for i, data := range combinedData {
+		if matchesAnyPattern(wanInterfaces, data.Interface) {
+			descriptions[i] = data.Device
+			continue
+		}
+		// A device missing from the traffic counters was unplugged, so
+		// whatever comes back under its name needs a fresh description.
+		if _, exists := networkTraffic[data.Device]; !exists {
+			collectorCache.invalidate("ifusb", data.Device)
+		}
+		i, device := i, data.Device
+		lookups = append(lookups, func(ctx context.Context) error {
+			defer observeCollector("ifusb", time.Now())
+			descriptions[i], descriptionErrs[i] = cached("ifusb", device, func() (string, error) {
+				if isIPhethDevice(device) {
+					return getIPhethDescription(ctx, device)
 				}
-				iface := data.Interface
+				return getUSBDevice(ctx, device)
+			})
+			return nil
+		})
+	}
+	// A device without a description is only left out of the cycle.
+	runConcurrently(ctx, lookups...)
 
-				uptimeInSeconds := parseUptimeToSeconds(data.Uptime)
-				onlineTimeInSeconds := parseUptimeToSeconds(data.OnlineTime)
+	devices := make([]string, len(combinedData))
+	deviceLabels := make([]string, len(combinedData))
+	for i, data := range combinedData {
+		devices[i] = data.Device
+		if descriptionErrs[i] == nil {
+			deviceLabels[i] = deviceLabel(data.Device, descriptions[i])
+		}
+	}
+	disambiguateDeviceLabels(devices, deviceLabels, deviceDisambiguator)
 
-				status := data.Status
-				tracking := data.Tracking
+	// Every sample of the cycle shares this timestamp.
+	now := time.Now()
 
-				statusOnline := 0.0
-				if status == "online" {
-					statusOnline = 1.0
-				}
+	var timeSeriesList []promremote.TimeSeries
+	present := make(map[string][]promremote.Label)
+	for i, data := range combinedData {
+		if err := descriptionErrs[i]; err != nil {
+			collectorLog.Error("Error getting USB device", "interface", data.Interface, "device", data.Device, "err", err)
+			present[data.Interface] = nil
+			continue
+		}
+		device := deviceLabels[i]
+		tether := !matchesAnyPattern(wanInterfaces, data.Interface)
+		data.Description = descriptions[i]
+		cycle.Interfaces = append(cycle.Interfaces, data)
+		iface := data.Interface
 
-				statusEnabled := 0.0
-				if status != "disabled" {
-					statusEnabled = 1.0
-				}
+		labels := []promremote.Label{
+			{Name: "device", Value: device},
+			{Name: "interface", Value: iface},
+		}
+
+		modem := findModem(data.Device)
+		carrier, err := cached("modem", "carrier/"+iface, func() (string, error) {
+			return getCarrier(modem)
+		})
+		if err != nil && err != errNoModem {
+			collectorLog.Warn("Error getting carrier", "interface", iface, "err", err)
+		}
+		if carrier != "" {
+			labels = append(labels, promremote.Label{Name: "carrier", Value: carrier})
+		}
+		present[iface] = slices.Clone(labels)
+
+		trackStateChange(data, device, now)
 
-				statusTracking := 0.0
-				if tracking == "active" {
-					statusTracking = 1.0
+		timeSeriesList = append(timeSeriesList, interfaceTimeSeries(data, labels, now)...)
+		if traffic, exists := networkTraffic[data.Device]; exists {
+			timeSeriesList = append(timeSeriesList, trafficTimeSeries(traffic, labels, now)...)
+
+			period := usage.update(iface, data.RX, data.TX, now)
+			checkDataCap(iface, device, period, now)
+			timeSeriesList = append(timeSeriesList,
+				newTimeSeries("tether_iface_period_bytes", float64(period.RX), now, append(labels, promremote.Label{Name: "direction", Value: "rx"})),
+				newTimeSeries("tether_iface_period_bytes", float64(period.TX), now, append(labels, promremote.Label{Name: "direction", Value: "tx"})),
+			)
+			if dataCap := dataCapFor(iface, device); dataCap > 0 {
+				quotaExceeded := 0.0
+				if period.RX+period.TX >= dataCap {
+					quotaExceeded = 1.0
 				}
+				timeSeriesList = append(timeSeriesList,
+					newTimeSeries("tether_iface_period_cap_percent", float64(period.RX+period.TX)/float64(dataCap)*100, now, labels),
+					newTimeSeries("tether_iface_quota_exceeded", quotaExceeded, now, labels),
+				)
+			}
+		}
 
-				// Add metrics to the time series list
-				timeSeriesList = append(timeSeriesList, promremote.TimeSeries{
-					Labels: []promremote.Label{
-						{Name: "__name__", Value: "tether_iface_up_time"},
-						{Name: "device", Value: device},
-						{Name: "interface", Value: iface},
-					},
-					Datapoint: promremote.Datapoint{
-						Timestamp: time.Now(),
-						Value:     uptimeInSeconds,
-					},
-				})
+		timeSeriesList = append(timeSeriesList, cachedTimeSeries("link", iface, now, func(now time.Time) ([]promremote.TimeSeries, bool) {
+			return collectLinkAttributes(data.Device, labels, now)
+		})...)
+		if tether {
+			timeSeriesList = append(timeSeriesList, collectUSBIdentity(data.Device, labels, now)...)
+		}
 
-				timeSeriesList = append(timeSeriesList, promremote.TimeSeries{
-					Labels: []promremote.Label{
-						{Name: "__name__", Value: "tether_iface_online_time"},
-						{Name: "device", Value: device},
-						{Name: "interface", Value: iface},
-					},
-					Datapoint: promremote.Datapoint{
-						Timestamp: time.Now(),
-						Value:     onlineTimeInSeconds,
-					},
-				})
+		start := time.Now()
+		ifaceStatus, err := getInterfaceStatus(iface)
+		observeCollector("netifd", start)
+		if err != nil {
+			collectorLog.Warn("Error getting interface status", "interface", iface, "err", err)
+		} else {
+			timeSeriesList = append(timeSeriesList, collectWANDHCP(iface, ifaceStatus, labels, now)...)
+			timeSeriesList = append(timeSeriesList, collectWANAddresses(iface, ifaceStatus, labels, now)...)
+			if collectGateway {
+				timeSeriesList = append(timeSeriesList, cachedTimeSeries("gateway", iface, now, func(now time.Time) ([]promremote.TimeSeries, bool) {
+					return collectGatewayReachability(data.Device, ifaceStatus, labels, now)
+				})...)
+			}
+			if dnsProbeHostname != "" {
+				timeSeriesList = append(timeSeriesList, cachedTimeSeries("dnsprobe", iface, now, func(now time.Time) ([]promremote.TimeSeries, bool) {
+					return collectDNSProbe(data.Device, ifaceStatus, labels, now)
+				})...)
+			}
+			if speedtestTool != "" {
+				timeSeriesList = append(timeSeriesList, collectSpeedtest(iface, data.Device, ifaceStatus, labels, now)...)
+			}
+		}
 
-				timeSeriesList = append(timeSeriesList, promremote.TimeSeries{
-					Labels: []promremote.Label{
-						{Name: "__name__", Value: "tether_iface_status_online"},
-						{Name: "device", Value: device},
-						{Name: "interface", Value: iface},
-					},
-					Datapoint: promremote.Datapoint{
-						Timestamp: time.Now(),
-						Value:     statusOnline,
-					},
-				})
+		if collectIPv6State {
+			timeSeriesList = append(timeSeriesList, cachedTimeSeries("ipv6", iface, now, func(now time.Time) ([]promremote.TimeSeries, bool) {
+				return collectIPv6(iface, data.Device, labels, now)
+			})...)
+		}
 
-				timeSeriesList = append(timeSeriesList, promremote.TimeSeries{
-					Labels: []promremote.Label{
-						{Name: "__name__", Value: "tether_iface_status_enabled"},
-						{Name: "device", Value: device},
-						{Name: "interface", Value: iface},
-					},
-					Datapoint: promremote.Datapoint{
-						Timestamp: time.Now(),
-						Value:     statusEnabled,
-					},
-				})
+		timeSeriesList = append(timeSeriesList, cachedTimeSeries("mwan3track", iface, now, func(now time.Time) ([]promremote.TimeSeries, bool) {
+			return collectMwan3Tracking(iface, labels, now)
+		})...)
 
-				timeSeriesList = append(timeSeriesList, promremote.TimeSeries{
-					Labels: []promremote.Label{
-						{Name: "__name__", Value: "tether_iface_status_tracking"},
-						{Name: "device", Value: device},
-						{Name: "interface", Value: iface},
-					},
-					Datapoint: promremote.Datapoint{
-						Timestamp: time.Now(),
-						Value:     statusTracking,
-					},
-				})
+		if tether {
+			timeSeriesList = append(timeSeriesList, cachedTimeSeries("mwan3route", iface, now, func(now time.Time) ([]promremote.TimeSeries, bool) {
+				return collectMwan3DefaultRoute(iface, labels, now)
+			})...)
+		}
 
-				timeSeriesList = append(timeSeriesList, promremote.TimeSeries{
-					Labels: []promremote.Label{
-						{Name: "__name__", Value: "tether_iface_tx"},
-						{Name: "device", Value: device},
-						{Name: "interface", Value: iface},
-					},
-					Datapoint: promremote.Datapoint{
-						Timestamp: time.Now(),
-						Value:     float64(data.TX),
-					},
-				})
+		if httpProbeURL != "" {
+			timeSeriesList = append(timeSeriesList, cachedTimeSeries("httpprobe", iface, now, func(now time.Time) ([]promremote.TimeSeries, bool) {
+				return collectHTTPProbe(data.Device, labels, now)
+			})...)
+		}
 
-				timeSeriesList = append(timeSeriesList, promremote.TimeSeries{
-					Labels: []promremote.Label{
-						{Name: "__name__", Value: "tether_iface_rx"},
-						{Name: "device", Value: device},
-						{Name: "interface", Value: iface},
-					},
-					Datapoint: promremote.Datapoint{
-						Timestamp: time.Now(),
-						Value:     float64(data.RX),
-					},
-				})
-			}
+		if probeTarget != "" {
+			timeSeriesList = append(timeSeriesList, cachedTimeSeries("probe", iface, now, func(now time.Time) ([]promremote.TimeSeries, bool) {
+				return collectProbe(data.Device, labels, now)
+			})...)
+		}
+
+		timeSeriesList = append(timeSeriesList, cachedTimeSeries("modem", iface, now, func(now time.Time) ([]promremote.TimeSeries, bool) {
+			return collectModemMetrics(modem, labels, now)
+		})...)
+
+		if tether {
+			timeSeriesList = append(timeSeriesList, cachedTimeSeries("battery", iface, now, func(now time.Time) ([]promremote.TimeSeries, bool) {
+				return collectPhoneBattery(modem, labels, now)
+			})...)
+		}
+
+		if modemWatchdogFailedProbes > 0 && tether {
+			timeSeriesList = append(timeSeriesList, modemWatchdog(modem, data, labels, now)...)
+		}
+
+		if remediationOfflineIntervals > 0 && tether {
+			timeSeriesList = append(timeSeriesList, remediate(data, labels, now)...)
+		}
+
+		if restartAction != "" {
+			timeSeriesList = append(timeSeriesList, restartInterface(data, labels, now)...)
+		}
+	}
+
+	timeSeriesList = append(timeSeriesList, interfaceStaleness.observe("", present, now)...)
+	timeSeriesList = append(timeSeriesList, cachedTimeSeries("dhcp", "", now, collectLANLeases)...)
+	timeSeriesList = append(timeSeriesList, collectBootTime(now)...)
+
+	if watchFailoverEvents {
+		timeSeriesList = append(timeSeriesList, failoverCounters.collect(now)...)
+	}
+
+	if collectClients {
+		timeSeriesList = append(timeSeriesList, cachedTimeSeries("clients", "", now, collectClientTraffic)...)
+	}
+
+	if collectConntrackSessions {
+		timeSeriesList = append(timeSeriesList, cachedTimeSeries("conntrack", "", now, collectConntrack)...)
+	}
+
+	if collectSystem {
+		timeSeriesList = append(timeSeriesList, cachedTimeSeries("system", "", now, collectSystemResources)...)
+	}
+
+	if collectThermal {
+		timeSeriesList = append(timeSeriesList, cachedTimeSeries("thermal", "", now, collectThermalZones)...)
+	}
+
+	if collectMwan3PolicyMetrics {
+		timeSeriesList = append(timeSeriesList, cachedTimeSeries("mwan3policy", "", now, collectMwan3Policies)...)
+	}
+
+	if collectWifiStations {
+		timeSeriesList = append(timeSeriesList, cachedTimeSeries("wifi", "", now, collectWifi)...)
+	}
+
+	if collectWireGuardPeers {
+		timeSeriesList = append(timeSeriesList, cachedTimeSeries("wireguard", "", now, collectWireGuard)...)
+	}
+
+	if len(openVPNStatusFiles) > 0 {
+		timeSeriesList = append(timeSeriesList, cachedTimeSeries("openvpn", "", now, collectOpenVPN)...)
+	}
+
+	if err := usage.maybeSave(now); err != nil {
+		collectorLog.Error("Error saving usage state", "err", err)
+	}
+
+	timeSeriesList = append(timeSeriesList, collectSelfMetrics(now)...)
+
+	applyStaticLabels(timeSeriesList, staticLabels)
+	timeSeriesList = relabel(timeSeriesList, relabelRules)
+	alerts.evaluate(timeSeriesList, now)
+
+	cycle.TimeSeries = timeSeriesList
+	collectorLog.Debug("Collection finished", "interfaces", len(cycle.Interfaces), "series", len(cycle.TimeSeries), "duration", time.Since(cycle.Time))
+	return cycle
+}
+
+// interfaceTimeSeries returns the base series of an interface: its mwan3
+// status and byte counters.
+func interfaceTimeSeries(data CombinedData, labels []promremote.Label, now time.Time) []promremote.TimeSeries {
+	uptimeInSeconds := parseUptimeToSeconds(data.Uptime)
+	onlineTimeInSeconds := parseUptimeToSeconds(data.OnlineTime)
+
+	status := data.Status
+	tracking := data.Tracking
+
+	statusOnline := 0.0
+	if status == "online" {
+		statusOnline = 1.0
+	}
+
+	statusEnabled := 0.0
+	if status != "disabled" {
+		statusEnabled = 1.0
+	}
+
+	statusTracking := 0.0
+	if tracking == "active" {
+		statusTracking = 1.0
+	}
+
+	return []promremote.TimeSeries{
+		newTimeSeries("tether_iface_up_time", uptimeInSeconds, now, labels),
+		newTimeSeries("tether_iface_online_time", onlineTimeInSeconds, now, labels),
+		newTimeSeries("tether_iface_status_online", statusOnline, now, labels),
+		newTimeSeries("tether_iface_status_enabled", statusEnabled, now, labels),
+		newTimeSeries("tether_iface_status_tracking", statusTracking, now, labels),
+		newTimeSeries("tether_iface_tx", float64(data.TX), now, labels),
+		newTimeSeries("tether_iface_rx", float64(data.RX), now, labels),
+	}
+}
+
+func trafficTimeSeries(traffic NetworkTraffic, labels []promremote.Label, now time.Time) []promremote.TimeSeries {
+	return []promremote.TimeSeries{
+		newTimeSeries("tether_iface_rx_packets", float64(traffic.RXPackets), now, labels),
+		newTimeSeries("tether_iface_tx_packets", float64(traffic.TXPackets), now, labels),
+		newTimeSeries("tether_iface_rx_errors", float64(traffic.RXErrors), now, labels),
+		newTimeSeries("tether_iface_tx_errors", float64(traffic.TXErrors), now, labels),
+		newTimeSeries("tether_iface_rx_dropped", float64(traffic.RXDropped), now, labels),
+		newTimeSeries("tether_iface_tx_dropped", float64(traffic.TXDropped), now, labels),
+	}
+}
+
+// writeOutput runs a single output's write and records its outcome.
+func writeOutput(output string, samples int, write func() error) error {
+	start := time.Now()
+	err := write()
+	observePush(output, time.Since(start), samples, err)
+	if err != nil {
+		pusherLog.Error("Error writing metrics", "output", output, "err", err)
+		return fmt.Errorf("%s: %w", output, err)
+	}
+	health.pushed(time.Now())
+	return nil
+}
+
+// publish sends a cycle's results to every configured output and returns
+// the errors of the outputs that failed.
+func publish(cycle Cycle) error {
+	if dryRun {
+		return printDryRun(cycle)
+	}
+	if httpListenAddress != "" {
+		liveState.record(cycle)
+	}
 
+	samples := len(cycle.TimeSeries)
+	var errs []error
+
+	if pushURL != "" {
+		errs = append(errs, writeOutput("remote_write", samples, func() error { return pushMetrics(cycle.TimeSeries) }))
+	}
+	if pushgatewayURL != "" {
+		errs = append(errs, writeOutput("pushgateway", samples, func() error { return writePushgateway(cycle.TimeSeries) }))
+	}
+	if influxURL != "" {
+		errs = append(errs, writeOutput("influxdb", samples, func() error { return writeInflux(cycle.TimeSeries) }))
+	}
+	if otlpEndpoint != "" {
+		errs = append(errs, writeOutput("otlp", samples, func() error { return writeOTLP(cycle.TimeSeries) }))
+	}
+	if graphiteAddress != "" {
+		errs = append(errs, writeOutput("graphite", samples, func() error { return writeGraphite(cycle.TimeSeries) }))
+	}
+	if statsdAddress != "" {
+		errs = append(errs, writeOutput("statsd", len(cycle.Interfaces), func() error { return writeStatsd(cycle) }))
+	}
+	if historyDir != "" {
+		errs = append(errs, writeOutput("history", samples, func() error { return appendHistory(cycle) }))
+	}
+	if jsonOutput != "" {
+		errs = append(errs, writeOutput("json", samples, func() error { return writeJSONLines(jsonOutput, cycle) }))
+	}
+	if textfilePath != "" {
+		errs = append(errs, writeOutput("textfile", samples, func() error { return writeTextfile(textfilePath, cycle.TimeSeries) }))
+	}
+	if mqttURL != "" {
+		errs = append(errs, writeOutput("mqtt", len(cycle.Interfaces), func() error { return publishMQTT(cycle) }))
+	}
+	if aggregatorURL != "" {
+		errs = append(errs, writeOutput("aggregator", samples, func() error { return writeAggregator(cycle) }))
+	}
+	return errors.Join(errs...)
+}
+
+func main() {
+	command, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	if command == "run" || command == "once" {
+		flags := flag.NewFlagSet(command, flag.ExitOnError)
+		flags.BoolVar(&dryRun, "dry-run", false, "print the collected series instead of writing them to any output")
+		flags.Parse(args)
+	}
+
+	switch command {
+	case "run":
+		setup()
+		run()
+	case "once":
+		// A single cycle for cron; the exit status tells whether every
+		// output accepted it.
+		oneShot = true
+		setup()
+		err := publish(collect())
+		waitForNotifications()
+		if err != nil {
+			os.Exit(1)
+		}
+	case "check":
+		if !check() {
+			os.Exit(1)
+		}
+	case "version":
+		fmt.Println(version)
+	default:
+		fmt.Fprintf(os.Stderr, "usage: %s [run|once|check|version] [--dry-run]\n", os.Args[0])
+		os.Exit(2)
+	}
+}
+
+// setup validates the configuration and initializes everything a cycle
+// needs, exiting on a fatal error.
+func setup() {
+	if err := validateParameters(); err != nil {
+		logger.Error("Parameter validation failed", "err", err)
+		os.Exit(1)
+	}
+	setupLogging()
+	var err error
+	pushTLSConfig, err = newTLSConfig(pushTLSCAFile, pushTLSCertFile, pushTLSKeyFile, pushTLSInsecure)
+	if err != nil {
+		logger.Error("TLS configuration failed", "err", err)
+		os.Exit(1)
+	}
+	if pushURL != "" {
+		remoteWriteClient, err = newRemoteWriteClient()
+		if err != nil {
+			logger.Error("Remote write configuration failed", "err", err)
+			os.Exit(1)
+		}
+	}
+	relabelRules, err = loadRelabelRules(relabelConfigFile)
+	if err != nil {
+		logger.Error("Relabel configuration failed", "err", err)
+		os.Exit(1)
+	}
+	alerts.rules, err = loadAlertRules(alertRulesFile)
+	if err != nil {
+		logger.Error("Alert rule configuration failed", "err", err)
+		os.Exit(1)
+	}
+	if pushOAuth2TokenURL != "" {
+		pushOAuth2 = &OAuth2TokenSource{
+			TokenURL:         pushOAuth2TokenURL,
+			ClientID:         pushOAuth2ClientID,
+			ClientSecret:     pushOAuth2ClientSecret,
+			ClientSecretFile: pushOAuth2ClientSecretFile,
+			Scopes:           pushOAuth2Scopes,
+			TLSConfig:        pushTLSConfig,
+		}
+	}
+	if fixturesDir != "" {
+		logger.Warn("Replaying command outputs from fixtures instead of running them", "dir", fixturesDir)
+		commandRunner = newFixtureRunner(fixturesDir, fixturesMutate)
+	}
+	usage = newUsageTracker(usageStateFile)
+	if dryRun {
+		// Nothing leaves the router in a dry run: no notifications and no
+		// remediation acting on the devices.
+		remediationOfflineIntervals = 0
+		modemWatchdogFailedProbes = 0
+		restartAction = ""
+		alertmanagerURL = ""
+		return
+	}
+	for _, url := range webhookURLs {
+		notifiers = append(notifiers, WebhookNotifier{URL: url})
+	}
+	for _, url := range slackWebhookURLs {
+		notifiers = append(notifiers, SlackNotifier{URL: url})
+	}
+	for _, url := range discordWebhookURLs {
+		notifiers = append(notifiers, DiscordNotifier{URL: url})
+	}
+	if stateChangeHook != "" {
+		notifiers = append(notifiers, ExecHookNotifier{Path: stateChangeHook})
+	}
+	if ntfyURL != "" {
+		notifiers = append(notifiers, NtfyNotifier{URL: ntfyURL, Token: ntfyToken, Priorities: ntfyPriorities})
+	}
+	if telegramBotToken != "" {
+		notifiers = append(notifiers, TelegramNotifier{Token: telegramBotToken, ChatID: telegramChatID})
+	}
+	if smtpAddress != "" {
+		// The templates were validated with the rest of the parameters.
+		emailNotifier, _ := newEmailNotifier(smtpAddress, smtpUsername, smtpPassword, smtpPasswordFile, smtpFrom, smtpTo, smtpSubjectTemplate, smtpBodyTemplate)
+		notifiers = append(notifiers, emailNotifier)
+	}
+}
+
+// run starts the background watchers and servers and collects on every
+// interval until the process is signalled.
+func run() {
+	// logread bypasses commandRunner, so fixtures can't replay it.
+	if watchFailoverEvents && fixturesDir == "" {
+		go watchMwan3Events()
+	}
+	if aggregatorMode {
+		httpMux.HandleFunc(aggregatorPushPath, aggregator.handler)
+	}
+	if httpListenAddress != "" {
+		startHTTPServer(httpListenAddress)
+	}
+	if pprofListenAddress != "" {
+		startPprofServer(pprofListenAddress)
+	}
+	hotplugTrigger := make(chan struct{}, 1)
+	if watchHotplugEvents {
+		go watchHotplug(hotplugTrigger)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	ticker := time.NewTicker(time.Duration(pushIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	// Each tick is delayed by a random part of the jitter so routers sharing
+	// an interval don't all write at the same second.
+	var jitterDelay <-chan time.Time
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			if pushJitterSeconds > 0 {
+				jitterDelay = time.After(time.Duration(rand.Int63n(int64(pushJitterSeconds) * int64(time.Second))))
+				continue
+			}
 			// Push metrics
-			pushMetrics(timeSeriesList)
+			publish(collect())
+
+		case <-jitterDelay:
+			jitterDelay = nil
+			publish(collect())
+
+		case <-hotplugTrigger:
+			// Collect out of band so plugged or removed devices show up immediately
+			publish(collect())
 
 		case sig := <-sigChan:
-			log.Printf("Received signal: %s. Exiting...\n", sig)
+			logger.Info("Received signal, exiting", "signal", sig)
 			break loop
 		}
 	}
+
+	shutdown()
+}
+
+// shutdown flushes what would otherwise be lost on exit and tells the
+// outputs the monitor is going away with a final tether_monitor_up of 0.
+// Collection is synchronous, so an in-flight cycle has already finished.
+func shutdown() {
+	if aggregatorMode {
+		// Forward what agents pushed since the last cycle.
+		publish(collect())
+	}
+
+	now := time.Now()
+	timeSeriesList := []promremote.TimeSeries{newTimeSeries("tether_monitor_up", 0, now, nil)}
+	applyStaticLabels(timeSeriesList, staticLabels)
+	timeSeriesList = relabel(timeSeriesList, relabelRules)
+	publish(Cycle{Time: now, TimeSeries: timeSeriesList})
+
+	if err := usage.save(); err != nil {
+		collectorLog.Error("Error saving usage state", "err", err)
+	}
+
+	waitForNotifications()
 }
@@ -0,0 +1,767 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+const atCommandTimeout = 5 * time.Second
+
+var errNoModem = errors.New("no modem control interface found")
+
+// Modem describes how to talk to the cellular modem behind a tether device.
+// Any field may be empty; QMI is preferred when both QMI and AT are available.
+// Tethered phones are reached over adb when debugging is enabled.
+type Modem struct {
+	QMIDevice string // e.g. /dev/cdc-wdm0, queried through uqmi
+	ATPort    string // e.g. /dev/ttyUSB2, queried with AT commands
+	ADBSerial string // adb serial of a tethered phone
+	Phone     bool   // the AT port belongs to a phone, per PHONE_DEVICES
+}
+
+func findModem(device string) Modem {
+	var modem Modem
+
+	// QMI modems expose their control channel as a cdc-wdm sibling of the
+	// network interface. The sysfs layout differs between kernel versions.
+	for _, pattern := range []string{
+		"/sys/class/net/" + device + "/device/usbmisc/cdc-wdm*",
+		"/sys/class/net/" + device + "/device/usb/cdc-wdm*",
+	} {
+		matches, _ := filepath.Glob(pattern)
+		if len(matches) > 0 {
+			modem.QMIDevice = "/dev/" + filepath.Base(matches[0])
+			break
+		}
+	}
+
+	modem.ATPort = modemATPorts[device]
+	modem.ADBSerial = adbSerials[device]
+	modem.Phone = slices.Contains(phoneDevices, device)
+	return modem
+}
+
+func executeQMICommand(qmiDevice string, args ...string) ([]byte, error) {
+	output, err := executeShellCommand("uqmi", append([]string{"-s", "-d", qmiDevice}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("Error executing uqmi %s on %s: %w", strings.Join(args, " "), qmiDevice, err)
+	}
+	return output, nil
+}
+
+// ATConn is an open AT serial port.
+type ATConn interface {
+	io.ReadWriteCloser
+	SetReadDeadline(t time.Time) error
+}
+
+// ATPortOpener opens the AT serial port of a modem. Like commandRunner, every
+// AT command goes through atPorts, so swapping it replaces the modems.
+type ATPortOpener interface {
+	Open(port string) (ATConn, error)
+}
+
+var atPorts ATPortOpener = SerialATPorts{}
+
+// SerialATPorts opens the serial ports of local modems.
+type SerialATPorts struct{}
+
+func (SerialATPorts) Open(port string) (ATConn, error) {
+	if _, err := executeShellCommand("stty", "-F", port, "raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("Error configuring %s: %w", port, err)
+	}
+
+	file, err := os.OpenFile(port, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening %s: %w", port, err)
+	}
+	return file, nil
+}
+
+// executeATCommand sends a single AT command to the given serial port and
+// returns the response lines, excluding the command echo and final result code.
+func executeATCommand(port, command string) ([]string, error) {
+	return executeATCommandUntil(port, command, "", atCommandTimeout)
+}
+
+// executeATCommandUntil is executeATCommand for commands whose answer is an
+// unsolicited result code after the final OK: unless urc is empty, it keeps
+// reading until a line starting with urc arrives and returns it last.
+func executeATCommandUntil(port, command, urc string, timeout time.Duration) ([]string, error) {
+	conn, err := atPorts.Open(port)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, command+"\r"); err != nil {
+		return nil, fmt.Errorf("Error writing to %s: %w", port, err)
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	var response strings.Builder
+	buf := make([]byte, 256)
+	for {
+		n, err := conn.Read(buf)
+		response.Write(buf[:n])
+
+		var lines []string
+		for _, line := range strings.Split(response.String(), "\n") {
+			line = strings.TrimSpace(line)
+			switch {
+			case line == "" || line == command:
+				continue
+			case line == "OK" && urc == "":
+				return lines, nil
+			case line == "OK":
+				continue
+			case urc != "" && strings.HasPrefix(line, urc):
+				return append(lines, line), nil
+			case line == "ERROR" || strings.HasPrefix(line, "+CME ERROR") || strings.HasPrefix(line, "+CMS ERROR"):
+				return nil, fmt.Errorf("%s on %s returned %s", command, port, line)
+			}
+			lines = append(lines, line)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Error reading response to %s from %s: %w", command, port, err)
+		}
+	}
+}
+
+var copsRegex = regexp.MustCompile(`\+COPS:\s*\d+,\d+,"([^"]*)"`)
+
+// getCarrier returns the name of the operator the modem is currently
+// registered on, or errNoModem if the device has no queryable modem.
+func getCarrier(modem Modem) (string, error) {
+	if modem.QMIDevice != "" {
+		output, err := executeQMICommand(modem.QMIDevice, "--get-serving-system")
+		if err != nil {
+			return "", err
+		}
+
+		var servingSystem struct {
+			Description string `json:"plmn_description"`
+		}
+		if err := json.Unmarshal(output, &servingSystem); err != nil {
+			return "", fmt.Errorf("Error unmarshalling uqmi serving system: %w", err)
+		}
+		return servingSystem.Description, nil
+	}
+
+	if modem.ATPort != "" {
+		lines, err := executeATCommand(modem.ATPort, "AT+COPS?")
+		if err != nil {
+			return "", err
+		}
+		for _, line := range lines {
+			if matches := copsRegex.FindStringSubmatch(line); len(matches) == 2 {
+				return matches[1], nil
+			}
+		}
+		return "", nil
+	}
+
+	return "", errNoModem
+}
+
+// SIMInfo identifies the SIM card currently active in a modem.
+type SIMInfo struct {
+	ICCID string
+	IMSI  string
+	Slot  string
+}
+
+var (
+	ccidRegex     = regexp.MustCompile(`^\+Q?CCID:\s*"?([0-9A-Fa-f]+)"?`)
+	quimslotRegex = regexp.MustCompile(`^\+QUIMSLOT:\s*(\d+)`)
+	imsiRegex     = regexp.MustCompile(`^\d{6,15}$`)
+)
+
+func getSIMInfo(modem Modem) (SIMInfo, error) {
+	var info SIMInfo
+
+	if modem.QMIDevice != "" {
+		for _, query := range []struct {
+			arg    string
+			target *string
+		}{
+			{"--get-iccid", &info.ICCID},
+			{"--get-imsi", &info.IMSI},
+		} {
+			output, err := executeQMICommand(modem.QMIDevice, query.arg)
+			if err != nil {
+				return info, err
+			}
+			if err := json.Unmarshal(output, query.target); err != nil {
+				return info, fmt.Errorf("Error unmarshalling uqmi %s output: %w", query.arg, err)
+			}
+		}
+		return info, nil
+	}
+
+	if modem.ATPort != "" {
+		lines, err := executeATCommand(modem.ATPort, "AT+CCID")
+		if err != nil {
+			// Quectel modems only understand the vendor-specific variant.
+			lines, err = executeATCommand(modem.ATPort, "AT+QCCID")
+		}
+		if err != nil {
+			return info, err
+		}
+		for _, line := range lines {
+			if matches := ccidRegex.FindStringSubmatch(line); len(matches) == 2 {
+				info.ICCID = matches[1]
+			}
+		}
+
+		lines, err = executeATCommand(modem.ATPort, "AT+CIMI")
+		if err != nil {
+			return info, err
+		}
+		for _, line := range lines {
+			if imsiRegex.MatchString(line) {
+				info.IMSI = line
+			}
+		}
+
+		// Slot selection is vendor-specific; ignore modems without it.
+		if lines, err := executeATCommand(modem.ATPort, "AT+QUIMSLOT?"); err == nil {
+			for _, line := range lines {
+				if matches := quimslotRegex.FindStringSubmatch(line); len(matches) == 2 {
+					info.Slot = matches[1]
+				}
+			}
+		}
+		return info, nil
+	}
+
+	return info, errNoModem
+}
+
+// hashIdentifier obscures a SIM identifier while keeping it stable across
+// restarts, so series can still be correlated without exposing the value.
+// ICCIDs and IMSIs are short enough to brute-force, hence the keyed hash.
+func hashIdentifier(key, value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// CellInfo describes a serving cell. With 5G NSA a modem reports one entry
+// for the LTE anchor and one for the NR leg.
+type CellInfo struct {
+	RAT    string // LTE, NR5G-SA or NR5G-NSA
+	CellID string
+	NodeID string // eNodeB ID for LTE, gNB ID for NR
+	Band   string
+	Signal map[string]float64
+}
+
+// signalLevels are the radio levels exported per serving cell, keyed as in
+// CellInfo.Signal, with the series each is exported as.
+var signalLevels = []struct{ key, metric string }{
+	{"rssi", "tether_modem_signal_rssi_dbm"},
+	{"rsrp", "tether_modem_signal_rsrp_dbm"},
+	{"rsrq", "tether_modem_signal_rsrq_db"},
+	{"sinr", "tether_modem_signal_sinr_db"},
+}
+
+// parseSignalFields reads the levels at the given QENG field indexes. Fields
+// the modem leaves out, as "-" or empty, are skipped.
+func parseSignalFields(fields []string, indexes map[string]int) map[string]float64 {
+	signal := make(map[string]float64)
+	for key, index := range indexes {
+		if index >= len(fields) {
+			continue
+		}
+		if value, err := strconv.ParseFloat(fields[index], 64); err == nil {
+			signal[key] = value
+		}
+	}
+	return signal
+}
+
+// nrGNBIDLength is the gNB ID length in bits assumed when splitting an NR
+// cell identity; 24 bits is what most operators deploy.
+const nrGNBIDLength = 24
+
+var (
+	qengRegex  = regexp.MustCompile(`^\+QENG:\s*(.*)$`)
+	digitRegex = regexp.MustCompile(`(\d+)\D*$`)
+)
+
+func getCellInfo(modem Modem) ([]CellInfo, error) {
+	if modem.QMIDevice != "" {
+		return getCellInfoQMI(modem.QMIDevice)
+	}
+	if modem.ATPort != "" {
+		return getCellInfoAT(modem.ATPort)
+	}
+	return nil, errNoModem
+}
+
+func getCellInfoQMI(qmiDevice string) ([]CellInfo, error) {
+	output, err := executeQMICommand(qmiDevice, "--get-system-info")
+	if err != nil {
+		return nil, err
+	}
+
+	var systemInfo struct {
+		LTE *struct {
+			ENodeBID int64 `json:"enodeb_id"`
+			CellID   int64 `json:"cell_id"`
+		} `json:"lte"`
+	}
+	if err := json.Unmarshal(output, &systemInfo); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling uqmi system info: %w", err)
+	}
+	if systemInfo.LTE == nil {
+		return nil, nil
+	}
+
+	cell := CellInfo{
+		RAT:    "LTE",
+		CellID: strconv.FormatInt(systemInfo.LTE.ENodeBID*256+systemInfo.LTE.CellID, 10),
+		NodeID: strconv.FormatInt(systemInfo.LTE.ENodeBID, 10),
+	}
+
+	// Band information needs a newer uqmi; missing support is not an error.
+	if output, err := executeQMICommand(qmiDevice, "--get-lte-cphy-ca-info"); err == nil {
+		var caInfo struct {
+			Primary struct {
+				Band json.RawMessage `json:"band"`
+			} `json:"primary"`
+		}
+		if json.Unmarshal(output, &caInfo) == nil {
+			if matches := digitRegex.FindStringSubmatch(string(caInfo.Primary.Band)); len(matches) == 2 {
+				cell.Band = matches[1]
+			}
+		}
+	}
+
+	return []CellInfo{cell}, nil
+}
+
+// getCellInfoAT parses the Quectel AT+QENG="servingcell" report, the de facto
+// standard on the modems commonly found in OpenWrt routers.
+func getCellInfoAT(port string) ([]CellInfo, error) {
+	lines, err := executeATCommand(port, `AT+QENG="servingcell"`)
+	if err != nil {
+		return nil, err
+	}
+
+	var cells []CellInfo
+	for _, line := range lines {
+		matches := qengRegex.FindStringSubmatch(line)
+		if len(matches) != 2 {
+			continue
+		}
+		fields := strings.Split(matches[1], ",")
+		for i := range fields {
+			fields[i] = strings.Trim(strings.TrimSpace(fields[i]), `"`)
+		}
+
+		// Standalone cells are reported on the "servingcell" line; NSA
+		// devices report separate "LTE" and "NR5G-NSA" lines instead.
+		if fields[0] == "servingcell" && len(fields) > 2 {
+			fields = fields[2:]
+		}
+
+		switch {
+		case fields[0] == "LTE" && len(fields) > 8:
+			// LTE,<is_tdd>,<MCC>,<MNC>,<cellID>,<PCID>,<earfcn>,<band>,
+			// <UL_bw>,<DL_bw>,<TAC>,<RSRP>,<RSRQ>,<RSSI>,<SINR>,...
+			cellID, err := strconv.ParseInt(fields[4], 16, 64)
+			if err != nil {
+				continue
+			}
+			cells = append(cells, CellInfo{
+				RAT:    "LTE",
+				CellID: strconv.FormatInt(cellID, 10),
+				NodeID: strconv.FormatInt(cellID>>8, 10),
+				Band:   fields[7],
+				Signal: parseSignalFields(fields, map[string]int{"rsrp": 11, "rsrq": 12, "rssi": 13, "sinr": 14}),
+			})
+		case fields[0] == "NR5G-SA" && len(fields) > 10:
+			// NR5G-SA,<duplex>,<MCC>,<MNC>,<cellID>,<PCID>,<TAC>,<ARFCN>,<band>,
+			// <NR_DL_bw>,<RSRP>,<RSRQ>,<SINR>,...
+			cellID, err := strconv.ParseInt(fields[4], 16, 64)
+			if err != nil {
+				continue
+			}
+			cells = append(cells, CellInfo{
+				RAT:    "NR5G-SA",
+				CellID: strconv.FormatInt(cellID, 10),
+				NodeID: strconv.FormatInt(cellID>>(36-nrGNBIDLength), 10),
+				Band:   fields[8],
+				Signal: parseSignalFields(fields, map[string]int{"rsrp": 10, "rsrq": 11, "sinr": 12}),
+			})
+		case fields[0] == "NR5G-NSA" && len(fields) > 8:
+			// NR5G-NSA,<MCC>,<MNC>,<PCID>,<RSRP>,<SINR>,<RSRQ>,<ARFCN>,<band>
+			// The NR leg of an NSA connection carries no cell identity.
+			cells = append(cells, CellInfo{
+				RAT:    "NR5G-NSA",
+				Band:   fields[8],
+				Signal: parseSignalFields(fields, map[string]int{"rsrp": 4, "sinr": 5, "rsrq": 6}),
+			})
+		}
+	}
+
+	return cells, nil
+}
+
+// accessTechnologies are the values of the rat label of
+// tether_modem_access_technology, from the slowest to the fastest.
+var accessTechnologies = []string{"2G", "3G", "LTE", "NR5G-NSA", "NR5G-SA"}
+
+// copsAcTRegex captures the <AcT> field of an AT+COPS? response.
+var copsAcTRegex = regexp.MustCompile(`\+COPS:\s*\d+,\d+,"[^"]*",(\d+)`)
+
+// getAccessTechnology returns the radio access technology the modem is
+// attached with. Modems commonly report an NSA connection as plain LTE, so
+// an NR5G-NSA serving cell upgrades LTE to NR5G-NSA. Over QMI the same
+// report carries the signal levels, which are returned as well; over AT
+// they come with the cells instead.
+func getAccessTechnology(modem Modem, cells []CellInfo) (string, map[string]float64, error) {
+	var rat string
+	var signal map[string]float64
+	switch {
+	case modem.QMIDevice != "":
+		output, err := executeQMICommand(modem.QMIDevice, "--get-signal-info")
+		if err != nil {
+			return "", nil, err
+		}
+		var signalInfo struct {
+			Type string   `json:"type"`
+			RSSI *float64 `json:"rssi"`
+			RSRP *float64 `json:"rsrp"`
+			RSRQ *float64 `json:"rsrq"`
+			SNR  *float64 `json:"snr"`
+		}
+		if err := json.Unmarshal(output, &signalInfo); err != nil {
+			return "", nil, fmt.Errorf("Error unmarshalling uqmi signal info: %w", err)
+		}
+		signal = make(map[string]float64)
+		for key, value := range map[string]*float64{"rssi": signalInfo.RSSI, "rsrp": signalInfo.RSRP, "rsrq": signalInfo.RSRQ, "sinr": signalInfo.SNR} {
+			if value != nil {
+				signal[key] = *value
+			}
+		}
+		switch signalInfo.Type {
+		case "gsm", "cdma":
+			rat = "2G"
+		case "wcdma", "tdscdma", "hdr":
+			rat = "3G"
+		case "lte":
+			rat = "LTE"
+		case "5gnr", "nr5g":
+			rat = "NR5G-SA"
+		}
+
+	case modem.ATPort != "":
+		lines, err := executeATCommand(modem.ATPort, "AT+COPS?")
+		if err != nil {
+			return "", nil, err
+		}
+		for _, line := range lines {
+			matches := copsAcTRegex.FindStringSubmatch(line)
+			if len(matches) != 2 {
+				continue
+			}
+			// 3GPP TS 27.007 <AcT> values.
+			switch matches[1] {
+			case "0", "1", "3":
+				rat = "2G"
+			case "2", "4", "5", "6":
+				rat = "3G"
+			case "7", "8", "9", "10":
+				rat = "LTE"
+			case "11", "12":
+				rat = "NR5G-SA"
+			case "13":
+				rat = "NR5G-NSA"
+			}
+		}
+
+	default:
+		return "", nil, errNoModem
+	}
+
+	if rat == "LTE" {
+		for _, cell := range cells {
+			if cell.RAT == "NR5G-NSA" {
+				rat = "NR5G-NSA"
+			}
+		}
+	}
+	return rat, signal, nil
+}
+
+// PDPContext is a packet data profile configured on the modem.
+type PDPContext struct {
+	Profile string
+	APN     string
+	PDPType string
+}
+
+var (
+	cgdcontRegex = regexp.MustCompile(`^\+CGDCONT:\s*(\d+),"([^"]*)","([^"]*)"`)
+	cgactRegex   = regexp.MustCompile(`^\+CGACT:\s*(\d+),1`)
+)
+
+// getPDPContext returns the profile the modem connects with. Over QMI that's
+// the default 3GPP profile, over AT the first active context.
+func getPDPContext(modem Modem) (PDPContext, error) {
+	if modem.QMIDevice != "" {
+		output, err := executeQMICommand(modem.QMIDevice, "--get-profile-settings", "3gpp,1")
+		if err != nil {
+			return PDPContext{}, err
+		}
+		var profile struct {
+			APN     string `json:"apn"`
+			PDPType string `json:"pdp-type"`
+		}
+		if err := json.Unmarshal(output, &profile); err != nil {
+			return PDPContext{}, fmt.Errorf("Error unmarshalling uqmi profile settings: %w", err)
+		}
+		return PDPContext{Profile: "1", APN: profile.APN, PDPType: profile.PDPType}, nil
+	}
+
+	if modem.ATPort != "" {
+		lines, err := executeATCommand(modem.ATPort, "AT+CGACT?")
+		if err != nil {
+			return PDPContext{}, err
+		}
+		active := ""
+		for _, line := range lines {
+			if matches := cgactRegex.FindStringSubmatch(line); len(matches) == 2 && active == "" {
+				active = matches[1]
+			}
+		}
+
+		lines, err = executeATCommand(modem.ATPort, "AT+CGDCONT?")
+		if err != nil {
+			return PDPContext{}, err
+		}
+		var pdp PDPContext
+		for _, line := range lines {
+			matches := cgdcontRegex.FindStringSubmatch(line)
+			if len(matches) != 4 {
+				continue
+			}
+			// Without an active context, report the first configured one.
+			if matches[1] == active || (active == "" && pdp.Profile == "") {
+				pdp = PDPContext{Profile: matches[1], PDPType: matches[2], APN: matches[3]}
+			}
+		}
+		return pdp, nil
+	}
+
+	return PDPContext{}, errNoModem
+}
+
+// configuredAPN returns the APN set for the interface in /etc/config/network,
+// which after a SIM swap may no longer match what the modem uses.
+func configuredAPN(iface string) string {
+	output, err := executeShellCommand("uci", "-q", "get", "network."+iface+".apn")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// TemperatureReading is a single temperature sensor value.
+type TemperatureReading struct {
+	Sensor  string
+	Celsius float64
+}
+
+var (
+	qtempNamedRegex = regexp.MustCompile(`^\+QTEMP:\s*"([^"]+)","(-?\d+)"`)
+	qtempListRegex  = regexp.MustCompile(`^\+QTEMP:\s*(-?\d+(?:,\s*-?\d+)*)$`)
+)
+
+// qtempLegacySensors names the positional values reported by older Quectel
+// modems such as the EC25.
+var qtempLegacySensors = []string{"pmic", "xo", "pa"}
+
+func getTemperatures(modem Modem) ([]TemperatureReading, error) {
+	if modem.ATPort != "" {
+		lines, err := executeATCommand(modem.ATPort, "AT+QTEMP")
+		if err != nil {
+			return nil, err
+		}
+
+		var readings []TemperatureReading
+		for _, line := range lines {
+			if matches := qtempNamedRegex.FindStringSubmatch(line); len(matches) == 3 {
+				celsius, _ := strconv.ParseFloat(matches[2], 64)
+				readings = append(readings, TemperatureReading{Sensor: matches[1], Celsius: celsius})
+			} else if matches := qtempListRegex.FindStringSubmatch(line); len(matches) == 2 {
+				for i, value := range strings.Split(matches[1], ",") {
+					if i >= len(qtempLegacySensors) {
+						break
+					}
+					celsius, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+					readings = append(readings, TemperatureReading{Sensor: qtempLegacySensors[i], Celsius: celsius})
+				}
+			}
+		}
+
+		// Absent sensors report nonsense values such as -273.
+		valid := readings[:0]
+		for _, reading := range readings {
+			if reading.Celsius > -100 {
+				valid = append(valid, reading)
+			}
+		}
+		return valid, nil
+	}
+
+	if modem.ADBSerial != "" {
+		battery, err := getPhoneBattery(modem.ADBSerial)
+		if err != nil {
+			return nil, err
+		}
+		return []TemperatureReading{{Sensor: "battery", Celsius: battery.Temperature}}, nil
+	}
+
+	if modem.QMIDevice != "" {
+		// QMI has no portable temperature query.
+		return nil, nil
+	}
+
+	return nil, errNoModem
+}
+
+func collectModemMetrics(modem Modem, labels []promremote.Label, now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("modem", time.Now())
+
+	var timeSeriesList []promremote.TimeSeries
+	ok := true
+
+	iface := labelValue(labels, "interface")
+
+	simInfo, err := getSIMInfo(modem)
+	if err == nil {
+		if hashSIMIdentifiers {
+			key, err := resolveSecret(simHashKey, simHashKeyFile)
+			if err != nil {
+				// Never export the identifiers in the clear.
+				collectorLog.Error("Error reading SIM hash key", "err", err)
+				simInfo.ICCID, simInfo.IMSI = "", ""
+			} else {
+				simInfo.ICCID = hashIdentifier(key, simInfo.ICCID)
+				simInfo.IMSI = hashIdentifier(key, simInfo.IMSI)
+			}
+		}
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_modem_sim_info", 1, now, append(labels,
+			promremote.Label{Name: "iccid", Value: simInfo.ICCID},
+			promremote.Label{Name: "imsi", Value: simInfo.IMSI},
+			promremote.Label{Name: "slot", Value: simInfo.Slot},
+		)))
+	} else if err != errNoModem {
+		collectorLog.Warn("Error getting SIM info", "interface", iface, "err", err)
+		ok = false
+	}
+
+	cells, err := getCellInfo(modem)
+	if err != nil && err != errNoModem {
+		collectorLog.Warn("Error getting cell info", "interface", iface, "err", err)
+		ok = false
+	}
+	for _, cell := range cells {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_modem_cell_info", 1, now, append(labels,
+			promremote.Label{Name: "rat", Value: cell.RAT},
+			promremote.Label{Name: "cell_id", Value: cell.CellID},
+			promremote.Label{Name: "node_id", Value: cell.NodeID},
+			promremote.Label{Name: "band", Value: cell.Band},
+		)))
+	}
+
+	rat, signal, err := getAccessTechnology(modem, cells)
+	if err != nil && err != errNoModem {
+		collectorLog.Warn("Error getting access technology", "interface", iface, "err", err)
+		ok = false
+	}
+	// Levels are exported as the modem reports them, per serving cell.
+	signals := []CellInfo{{RAT: rat, Signal: signal}}
+	if signal == nil {
+		signals = cells
+	}
+	for _, cell := range signals {
+		for _, level := range signalLevels {
+			if value, exists := cell.Signal[level.key]; exists {
+				timeSeriesList = append(timeSeriesList, newTimeSeries(level.metric, value, now, append(labels,
+					promremote.Label{Name: "rat", Value: cell.RAT},
+				)))
+			}
+		}
+	}
+	if rat != "" {
+		// One series per technology, 1 for the current one, so a fallback
+		// shows up as a change of value rather than a new series.
+		for _, technology := range accessTechnologies {
+			current := 0.0
+			if technology == rat {
+				current = 1.0
+			}
+			timeSeriesList = append(timeSeriesList, newTimeSeries("tether_modem_access_technology", current, now, append(labels,
+				promremote.Label{Name: "rat", Value: technology},
+			)))
+		}
+	}
+
+	pdpContext, err := getPDPContext(modem)
+	if err == nil {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_modem_apn_info", 1, now, append(labels,
+			promremote.Label{Name: "apn", Value: pdpContext.APN},
+			promremote.Label{Name: "pdp_type", Value: pdpContext.PDPType},
+			promremote.Label{Name: "profile", Value: pdpContext.Profile},
+			promremote.Label{Name: "configured_apn", Value: configuredAPN(iface)},
+		)))
+	} else if err != errNoModem {
+		collectorLog.Warn("Error getting APN", "interface", iface, "err", err)
+		ok = false
+	}
+
+	temperatures, err := getTemperatures(modem)
+	if err != nil && err != errNoModem {
+		collectorLog.Warn("Error getting temperature", "interface", iface, "err", err)
+		ok = false
+	}
+	for _, reading := range temperatures {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_device_temperature_celsius", reading.Celsius, now, append(labels,
+			promremote.Label{Name: "sensor", Value: reading.Sensor},
+		)))
+	}
+
+	if collectSMSMessages {
+		timeSeriesList = append(timeSeriesList, collectSMS(modem, labels, now)...)
+	}
+
+	if ussdQueries[iface] != "" {
+		timeSeriesList = append(timeSeriesList, collectUSSDBalance(modem, labels, now)...)
+	}
+
+	return timeSeriesList, ok
+}
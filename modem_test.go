@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestGetCellInfoAT(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     []CellInfo
+	}{
+		{
+			name: "LTE",
+			response: "AT+QENG=\"servingcell\"\r\n" +
+				"+QENG: \"servingcell\",\"NOCONN\",\"LTE\",\"FDD\",310,260,A1B2C03,123,5110,12,5,5,2AF8,-95,-11,-65,12,40\r\n" +
+				"\r\nOK\r\n",
+			want: []CellInfo{
+				{RAT: "LTE", CellID: "169552899", NodeID: "662316", Band: "12", Signal: map[string]float64{"rsrp": -95, "rsrq": -11, "rssi": -65, "sinr": 12}},
+			},
+		},
+		{
+			name: "NR5G-NSA",
+			response: "+QENG: \"servingcell\",\"NOCONN\"\r\n" +
+				"+QENG: \"LTE\",\"FDD\",310,260,A1B2C03,123,5110,12,5,5,2AF8,-95,-11,-65,12,40\r\n" +
+				"+QENG: \"NR5G-NSA\",310,260,393,-88,15,-11,632448,77\r\n" +
+				"\r\nOK\r\n",
+			want: []CellInfo{
+				{RAT: "LTE", CellID: "169552899", NodeID: "662316", Band: "12", Signal: map[string]float64{"rsrp": -95, "rsrq": -11, "rssi": -65, "sinr": 12}},
+				{RAT: "NR5G-NSA", Band: "77", Signal: map[string]float64{"rsrp": -88, "sinr": 15, "rsrq": -11}},
+			},
+		},
+		{
+			name: "no service",
+			response: "+QENG: \"servingcell\",\"SEARCH\"\r\n" +
+				"\r\nOK\r\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ports := &FakeATPorts{Responses: map[string]string{`AT+QENG="servingcell"`: test.response}}
+			defer func(previous ATPortOpener) { atPorts = previous }(atPorts)
+			atPorts = ports
+
+			got, err := getCellInfoAT("/dev/ttyUSB2")
+			if err != nil {
+				t.Fatalf("getCellInfoAT() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("getCellInfoAT() = %+v, want %+v", got, test.want)
+			}
+			if !slices.Equal(ports.Calls, []string{`AT+QENG="servingcell"`}) {
+				t.Errorf("getCellInfoAT() sent %v", ports.Calls)
+			}
+		})
+	}
+}
+
+func TestExecuteATCommandError(t *testing.T) {
+	defer func(previous ATPortOpener) { atPorts = previous }(atPorts)
+	atPorts = &FakeATPorts{Responses: map[string]string{"AT+CCID": "\r\n+CME ERROR: 10\r\n"}}
+
+	if _, err := executeATCommand("/dev/ttyUSB2", "AT+CCID"); err == nil {
+		t.Error("executeATCommand() succeeded on +CME ERROR")
+	}
+}
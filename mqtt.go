@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	mqttTimeout   = 10 * time.Second
+	mqttKeepAlive = 60
+)
+
+// MQTT control packet types, already shifted into the fixed header.
+const (
+	mqttConnect    = 0x10
+	mqttConnack    = 0x20
+	mqttPublish    = 0x30
+	mqttDisconnect = 0xE0
+)
+
+// defaultMQTTClientID derives a client ID from the hostname. MQTT 3.1.1
+// brokers only have to accept IDs of up to 23 alphanumeric characters.
+func defaultMQTTClientID(hostname string) string {
+	sum := sha256.Sum256([]byte(hostname))
+	return "trm" + hex.EncodeToString(sum[:])[:16]
+}
+
+// mqttPublishRetained connects to the broker, publishes every message
+// retained with QoS 0 and disconnects again. Publishing once per interval
+// doesn't justify a persistent session or a full client library.
+func mqttPublishRetained(brokerURL, username, password string, messages map[string][]byte) error {
+	broker, err := url.Parse(brokerURL)
+	if err != nil {
+		return fmt.Errorf("invalid MQTT URL: %w", err)
+	}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+	switch broker.Scheme {
+	case "tcp", "mqtt":
+		conn, err = dialer.Dial("tcp", hostWithDefaultPort(broker, "1883"))
+	case "ssl", "tls", "mqtts":
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostWithDefaultPort(broker, "8883"), &tls.Config{ServerName: broker.Hostname()})
+	default:
+		return fmt.Errorf("unsupported MQTT scheme %q", broker.Scheme)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(mqttTimeout))
+
+	writer := bufio.NewWriter(conn)
+	if err := writeMQTTPacket(writer, mqttConnect, mqttConnectBody(username, password)); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	var connack [4]byte
+	if _, err := io.ReadFull(conn, connack[:]); err != nil {
+		return fmt.Errorf("Error reading CONNACK: %w", err)
+	}
+	if connack[0] != mqttConnack || connack[3] != 0 {
+		return fmt.Errorf("MQTT broker refused connection with code %d", connack[3])
+	}
+
+	for topic, payload := range messages {
+		var body bytes.Buffer
+		writeMQTTString(&body, topic)
+		body.Write(payload)
+		// 0x01 sets the retain flag so new subscribers get the latest state.
+		if err := writeMQTTPacket(writer, mqttPublish|0x01, body.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := writeMQTTPacket(writer, mqttDisconnect, nil); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+func hostWithDefaultPort(u *url.URL, port string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+func mqttConnectBody(username, password string) []byte {
+	var body bytes.Buffer
+	writeMQTTString(&body, "MQTT")
+	body.WriteByte(4) // protocol level 3.1.1
+
+	flags := byte(0x02) // clean session
+	if username != "" {
+		flags |= 0x80
+	}
+	if password != "" {
+		flags |= 0x40
+	}
+	body.WriteByte(flags)
+	binary.Write(&body, binary.BigEndian, uint16(mqttKeepAlive))
+
+	writeMQTTString(&body, mqttClientID)
+	if username != "" {
+		writeMQTTString(&body, username)
+	}
+	if password != "" {
+		writeMQTTString(&body, password)
+	}
+	return body.Bytes()
+}
+
+func writeMQTTString(buf *bytes.Buffer, value string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(value)))
+	buf.WriteString(value)
+}
+
+func writeMQTTPacket(w io.Writer, header byte, body []byte) error {
+	packet := []byte{header}
+	// The remaining length is encoded as a base-128 varint.
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(packet, body...))
+	return err
+}
+
+// MQTTState is the payload published per interface: its merged state plus
+// the modem's radio levels, keyed as in CellInfo.Signal.
+type MQTTState struct {
+	CombinedData
+	Signal map[string]float64 `json:"signal,omitempty"`
+}
+
+// publishMQTT publishes each interface's merged state to its own topic.
+func publishMQTT(cycle Cycle) error {
+	states := make(map[string]*MQTTState)
+	for _, data := range cycle.Interfaces {
+		states[data.Interface] = &MQTTState{CombinedData: data, Signal: make(map[string]float64)}
+	}
+	for _, ts := range cycle.TimeSeries {
+		state, exists := states[labelValue(ts.Labels, "interface")]
+		if !exists {
+			continue
+		}
+		// Series split by further labels, such as neighbour cells, only
+		// publish their first.
+		name := labelValue(ts.Labels, "__name__")
+		for _, level := range signalLevels {
+			if _, seen := state.Signal[level.key]; level.metric == name && !seen {
+				state.Signal[level.key] = ts.Datapoint.Value
+			}
+		}
+	}
+
+	messages := make(map[string][]byte)
+	for _, data := range cycle.Interfaces {
+		payload, err := json.Marshal(states[data.Interface])
+		if err != nil {
+			return err
+		}
+		topic := strings.NewReplacer("{interface}", data.Interface, "{device}", data.Device).Replace(mqttTopic)
+		messages[topic] = payload
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return mqttPublishRetained(mqttURL, mqttUsername, mqttPassword, messages)
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+const defaultMwan3MarkMask = 0x3F00
+
+var uciInterfaceSectionRegex = regexp.MustCompile(`^mwan3\.([^.=]+)=interface$`)
+
+// getMwan3Interfaces returns the mwan3 interfaces in configuration order.
+// mwan3 derives each interface's firewall mark from this order.
+func getMwan3Interfaces() ([]string, error) {
+	output, err := executeShellCommand("uci", "-q", "show", "mwan3")
+	if err != nil {
+		return nil, fmt.Errorf("Error executing uci show mwan3: %w", err)
+	}
+
+	var interfaces []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if matches := uciInterfaceSectionRegex.FindStringSubmatch(strings.TrimSpace(line)); len(matches) == 2 {
+			interfaces = append(interfaces, matches[1])
+		}
+	}
+	return interfaces, nil
+}
+
+func getMwan3MarkMask() uint32 {
+	output, err := executeShellCommand("uci", "-q", "get", "mwan3.globals.mmx_mask")
+	if err != nil {
+		return defaultMwan3MarkMask
+	}
+	mask, err := strconv.ParseUint(strings.TrimSpace(string(output)), 0, 32)
+	if err != nil || mask == 0 {
+		return defaultMwan3MarkMask
+	}
+	return uint32(mask)
+}
+
+// mwan3InterfaceForMark resolves a conntrack mark to the mwan3 interface it
+// was routed through, or "" when the mark doesn't belong to one.
+func mwan3InterfaceForMark(mark, mask uint32, interfaces []string) string {
+	id := int((mark & mask) >> bits.TrailingZeros32(mask))
+	if id < 1 || id > len(interfaces) {
+		return ""
+	}
+	return interfaces[id-1]
+}
+
+const mwan3TrackDir = "/var/run/mwan3track"
+
+// Mwan3TrackResult is mwan3track's latest verdict for one tracked host.
+// Latency and loss are only recorded when check_quality is enabled.
+type Mwan3TrackResult struct {
+	TrackIP string
+	Up      bool
+	Latency *time.Duration
+	Loss    *float64 // ratio
+}
+
+// getMwan3TrackResults reads the per-host state mwan3track keeps for an
+// interface, the same files `mwan3 status` reports from.
+func getMwan3TrackResults(iface string) ([]Mwan3TrackResult, error) {
+	dir := filepath.Join(mwan3TrackDir, iface)
+	matches, err := filepath.Glob(filepath.Join(dir, "TRACK_*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Mwan3TrackResult
+	for _, path := range matches {
+		trackIP := strings.TrimPrefix(filepath.Base(path), "TRACK_")
+		state, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		result := Mwan3TrackResult{
+			TrackIP: trackIP,
+			Up:      strings.TrimSpace(string(state)) == "up",
+		}
+		if latency, err := os.ReadFile(filepath.Join(dir, "LATENCY_"+trackIP)); err == nil {
+			if ms, err := strconv.ParseFloat(strings.TrimSpace(string(latency)), 64); err == nil {
+				duration := time.Duration(ms * float64(time.Millisecond))
+				result.Latency = &duration
+			}
+		}
+		if loss, err := os.ReadFile(filepath.Join(dir, "LOSS_"+trackIP)); err == nil {
+			if percent, err := strconv.ParseFloat(strings.TrimSpace(string(loss)), 64); err == nil {
+				ratio := percent / 100
+				result.Loss = &ratio
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func collectMwan3Tracking(iface string, labels []promremote.Label, now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("mwan3track", time.Now())
+
+	results, err := getMwan3TrackResults(iface)
+	if err != nil {
+		collectorLog.Warn("Error reading mwan3 tracking", "interface", iface, "err", err)
+		return nil, false
+	}
+
+	var timeSeriesList []promremote.TimeSeries
+	for _, result := range results {
+		trackLabels := append(labels, promremote.Label{Name: "track_ip", Value: result.TrackIP})
+
+		up := 0.0
+		if result.Up {
+			up = 1.0
+		}
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_mwan3_track_up", up, now, trackLabels))
+		if result.Latency != nil {
+			timeSeriesList = append(timeSeriesList, newTimeSeries("tether_mwan3_track_latency_seconds", result.Latency.Seconds(), now, trackLabels))
+		}
+		if result.Loss != nil {
+			timeSeriesList = append(timeSeriesList, newTimeSeries("tether_mwan3_track_loss_ratio", *result.Loss, now, trackLabels))
+		}
+	}
+	return timeSeriesList, true
+}
+
+// hasMwan3DefaultRoute reports whether mwan3's routing table for an
+// interface has a default route. mwan3 numbers its tables by the interface's
+// position in the configuration, like the firewall marks.
+func hasMwan3DefaultRoute(iface string, interfaces []string) (bool, error) {
+	id := slices.Index(interfaces, iface) + 1
+	if id == 0 {
+		return false, fmt.Errorf("%s is not an mwan3 interface", iface)
+	}
+	output, err := executeShellCommand("ip", "route", "show", "table", strconv.Itoa(id))
+	if err != nil {
+		return false, fmt.Errorf("Error executing ip route show table %d: %w", id, err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "default ") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// collectMwan3DefaultRoute exports whether a tether's mwan3 routing table
+// has a default route. netifd sometimes renegotiates an interface without
+// mwan3 restoring its table, which leaves the interface online but unused.
+func collectMwan3DefaultRoute(iface string, labels []promremote.Label, now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("mwan3route", time.Now())
+
+	interfaces, err := getMwan3Interfaces()
+	if err != nil {
+		collectorLog.Warn("Error getting mwan3 interfaces", "err", err)
+		return nil, false
+	}
+	present, err := hasMwan3DefaultRoute(iface, interfaces)
+	if err != nil {
+		collectorLog.Warn("Error checking mwan3 default route", "interface", iface, "err", err)
+		return nil, false
+	}
+	value := 0.0
+	if present {
+		value = 1.0
+	}
+	return []promremote.TimeSeries{newTimeSeries("tether_mwan3_default_route", value, now, labels)}, true
+}
+
+// UCISection is one section of `uci show` output with its list-valued
+// options.
+type UCISection struct {
+	Type    string
+	Options map[string][]string
+}
+
+var uciValueRegex = regexp.MustCompile(`'((?:[^']|'\\'')*)'`)
+
+// parseUCIShow parses `uci show <config>` output into its sections, keyed by
+// section name. Lists such as use_member='a' 'b' keep every value.
+func parseUCIShow(output string) map[string]*UCISection {
+	sections := make(map[string]*UCISection)
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if !found {
+			continue
+		}
+		parts := strings.Split(key, ".")
+		switch len(parts) {
+		case 2:
+			sections[parts[1]] = &UCISection{Type: value, Options: make(map[string][]string)}
+		case 3:
+			section, exists := sections[parts[1]]
+			if !exists {
+				continue
+			}
+			var values []string
+			for _, match := range uciValueRegex.FindAllStringSubmatch(value, -1) {
+				values = append(values, strings.ReplaceAll(match[1], `'\''`, "'"))
+			}
+			if len(values) == 0 {
+				values = []string{value}
+			}
+			section.Options[parts[2]] = values
+		}
+	}
+	return sections
+}
+
+func (s *UCISection) option(name string) string {
+	if values := s.Options[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Mwan3PolicyMember is an interface's current share of a policy.
+type Mwan3PolicyMember struct {
+	Interface string  `json:"interface"`
+	Percent   float64 `json:"percent"`
+}
+
+// getMwan3PolicyShares returns, per address family and policy, the share of
+// new connections mwan3 currently sends to each interface. Older mwan3
+// versions don't report policies over ubus, which leaves the map empty.
+func getMwan3PolicyShares() (map[string]map[string][]Mwan3PolicyMember, error) {
+	var status struct {
+		Policies map[string]map[string][]Mwan3PolicyMember `json:"policies"`
+	}
+	err := ubusCall(&status, "mwan3", "status", nil)
+	return status.Policies, err
+}
+
+// collectMwan3Policies exports how mwan3 is configured to split traffic:
+// the policy each rule uses, the metric and weight of every policy member,
+// and the share mwan3 reports for each interface of a policy.
+func collectMwan3Policies(now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("mwan3policy", time.Now())
+
+	output, err := executeShellCommand("uci", "-q", "show", "mwan3")
+	if err != nil {
+		collectorLog.Error("Error executing uci show mwan3", "err", err)
+		return nil, false
+	}
+	sections := parseUCIShow(string(output))
+
+	var timeSeriesList []promremote.TimeSeries
+	ok := true
+	for name, section := range sections {
+		switch section.Type {
+		case "rule":
+			timeSeriesList = append(timeSeriesList, newTimeSeries("tether_mwan3_rule_policy_info", 1, now, []promremote.Label{
+				{Name: "rule", Value: name},
+				{Name: "policy", Value: section.option("use_policy")},
+			}))
+		case "policy":
+			for _, memberName := range section.Options["use_member"] {
+				member, exists := sections[memberName]
+				if !exists {
+					continue
+				}
+				metric, _ := strconv.Atoi(member.option("metric"))
+				weight, err := strconv.Atoi(member.option("weight"))
+				if err != nil {
+					weight = 1
+				}
+				labels := []promremote.Label{
+					{Name: "policy", Value: name},
+					{Name: "member", Value: memberName},
+					{Name: "interface", Value: member.option("interface")},
+				}
+				timeSeriesList = append(timeSeriesList,
+					newTimeSeries("tether_mwan3_member_metric", float64(metric), now, labels),
+					newTimeSeries("tether_mwan3_member_weight", float64(weight), now, labels),
+				)
+			}
+		}
+	}
+
+	shares, err := getMwan3PolicyShares()
+	if err != nil {
+		collectorLog.Warn("Error getting mwan3 policy status", "err", err)
+		ok = false
+	}
+	for family, policies := range shares {
+		for policy, members := range policies {
+			for _, member := range members {
+				timeSeriesList = append(timeSeriesList, newTimeSeries("tether_mwan3_policy_share_ratio", member.Percent/100, now, []promremote.Label{
+					{Name: "policy", Value: policy},
+					{Name: "interface", Value: member.Interface},
+					{Name: "family", Value: family},
+				}))
+			}
+		}
+	}
+
+	return timeSeriesList, ok
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// InterfaceStatus is the subset of `ubus call network.interface.<name> status`
+// the monitor relies on.
+type InterfaceStatus struct {
+	Up        bool   `json:"up"`
+	Uptime    int64  `json:"uptime"`
+	Proto     string `json:"proto"`
+	L3Device  string `json:"l3_device"`
+	IPv4Addrs []struct {
+		Address string `json:"address"`
+		Mask    int    `json:"mask"`
+	} `json:"ipv4-address"`
+	IPv6Addrs []struct {
+		Address string `json:"address"`
+		Mask    int    `json:"mask"`
+	} `json:"ipv6-address"`
+	IPv6Prefixes []struct {
+		Address   string `json:"address"`
+		Mask      int    `json:"mask"`
+		Preferred int64  `json:"preferred"`
+		Valid     int64  `json:"valid"`
+	} `json:"ipv6-prefix"`
+	Routes []struct {
+		Target  string `json:"target"`
+		Mask    int    `json:"mask"`
+		Nexthop string `json:"nexthop"`
+		Valid   *int64 `json:"valid"` // remaining lifetime of routes learned from RAs
+	} `json:"route"`
+	DNSServers []string `json:"dns-server"`
+	Data       struct {
+		LeaseTime int64 `json:"leasetime"`
+	} `json:"data"`
+}
+
+func getInterfaceStatus(iface string) (InterfaceStatus, error) {
+	var status InterfaceStatus
+
+	output, err := executeShellCommand("ubus", "call", "network.interface."+iface, "status")
+	if err != nil {
+		return status, fmt.Errorf("Error executing ubus status for %s: %w", iface, err)
+	}
+	if err := json.Unmarshal(output, &status); err != nil {
+		return status, fmt.Errorf("Error unmarshalling ubus status for %s: %w", iface, err)
+	}
+	return status, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const notifyTimeout = 10 * time.Second
+
+// Event is something the notifier subsystem tells the user about.
+type Event struct {
+	Kind            string    `json:"kind"`
+	Alert           string    `json:"alert,omitempty"`
+	Severity        string    `json:"severity,omitempty"`
+	Status          string    `json:"status,omitempty"` // of alerts: firing or resolved
+	Interface       string    `json:"interface"`
+	Device          string    `json:"device"`
+	OldState        string    `json:"old_state,omitempty"`
+	NewState        string    `json:"new_state,omitempty"`
+	DowntimeSeconds float64   `json:"downtime_seconds,omitempty"`
+	DurationSeconds float64   `json:"duration_seconds,omitempty"` // spent in OldState
+	Message         string    `json:"message"`
+	Time            time.Time `json:"time"`
+}
+
+// Notifier delivers events to a single destination.
+type Notifier interface {
+	Notify(event Event) error
+}
+
+var notifiers []Notifier
+
+// pendingNotifications lets shutdown wait for notifications still being sent.
+var pendingNotifications sync.WaitGroup
+
+// notify hands an event to every configured notifier in the background so a
+// slow destination never delays collection.
+func notify(event Event) {
+	if len(notifiers) == 0 {
+		return
+	}
+	pendingNotifications.Add(1)
+	go func() {
+		defer pendingNotifications.Done()
+		for _, notifier := range notifiers {
+			if err := notifier.Notify(event); err != nil {
+				notifierLog.Error("Error sending notification", "kind", event.Kind, "interface", event.Interface, "err", err)
+			}
+		}
+	}()
+}
+
+// waitForNotifications gives notifications still being sent up to
+// notifyTimeout to finish before the process exits.
+func waitForNotifications() {
+	done := make(chan struct{})
+	go func() {
+		pendingNotifications.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(notifyTimeout):
+		notifierLog.Warn("Exiting with notifications still pending")
+	}
+}
+
+type interfaceState struct {
+	state string
+	since time.Time
+}
+
+var interfaceStates = make(map[string]interfaceState)
+
+// trackStateChange emits a state_change event whenever an interface moves
+// between online, offline and disabled. The first observation only records
+// the state.
+func trackStateChange(data CombinedData, device string, now time.Time) {
+	state := data.Status
+	if state != "online" && state != "disabled" {
+		state = "offline"
+	}
+
+	previous, exists := interfaceStates[data.Interface]
+	if exists && previous.state == state {
+		return
+	}
+	interfaceStates[data.Interface] = interfaceState{state: state, since: now}
+	if !exists {
+		return
+	}
+
+	event := Event{
+		Kind:            "state_change",
+		Interface:       data.Interface,
+		Device:          device,
+		OldState:        previous.state,
+		NewState:        state,
+		Time:            now,
+		DurationSeconds: now.Sub(previous.since).Seconds(),
+	}
+	if state == "online" {
+		downtime := now.Sub(previous.since)
+		event.DowntimeSeconds = downtime.Seconds()
+		event.Message = fmt.Sprintf("%s (%s) is online again after %s %s", data.Interface, device, previous.state, downtime.Round(time.Second))
+	} else {
+		event.Message = fmt.Sprintf("%s (%s) went %s", data.Interface, device, state)
+	}
+	notify(event)
+}
+
+// eventSeverity grades an event for notifiers that present severities
+// differently: critical, warning, info, or resolved for events that end a
+// problem. Alerts carry their rule's severity.
+func eventSeverity(event Event) string {
+	switch {
+	case event.Status == "resolved":
+		return "resolved"
+	case event.Severity != "":
+		return event.Severity
+	case event.Kind == "state_change" && event.NewState == "online":
+		return "resolved"
+	case event.Kind == "state_change" && event.NewState == "offline":
+		return "critical"
+	case event.Kind == "data_cap":
+		return "warning"
+	}
+	return "info"
+}
+
+// WebhookNotifier POSTs events as JSON to an arbitrary URL.
+type WebhookNotifier struct {
+	URL string
+}
+
+func (n WebhookNotifier) Notify(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return postNotification(n.URL, "application/json", payload)
+}
+
+func postNotification(url, contentType string, payload []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("Error building request to %s: invalid URL", redactURL(url))
+	}
+	req.Header.Set("Content-Type", contentType)
+	return sendNotification(req)
+}
+
+// sendNotification sends a notifier's request. Webhook URLs, bot API paths
+// and ntfy topics carry their secret in the path or query, so errors only
+// name the scheme and host.
+func sendNotification(req *http.Request) error {
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		// *url.Error repeats the full URL; keep only what went wrong.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("Error posting to %s: %w", redactURL(req.URL.String()), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected HTTP status %d from %s", resp.StatusCode, redactURL(req.URL.String()))
+	}
+	return nil
+}
+
+// redactURL strips everything but the scheme and host from a URL for logging.
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return "notification URL"
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// defaultNtfyPriorities maps event severities to ntfy priorities, from 1
+// (min) to 5 (urgent). NTFY_PRIORITIES overrides single entries.
+var defaultNtfyPriorities = map[string]string{
+	"critical": "5",
+	"warning":  "4",
+	"info":     "3",
+	"resolved": "3",
+}
+
+var ntfyTags = map[string]string{
+	"critical": "rotating_light",
+	"warning":  "warning",
+	"info":     "information_source",
+	"resolved": "white_check_mark",
+}
+
+// NtfyNotifier publishes events to an ntfy topic, on ntfy.sh or a
+// self-hosted server, for push notifications on a phone.
+type NtfyNotifier struct {
+	URL        string // of the topic, e.g. https://ntfy.sh/my-router
+	Token      string
+	Priorities map[string]string
+}
+
+func (n NtfyNotifier) Notify(event Event) error {
+	req, err := http.NewRequest("POST", n.URL, strings.NewReader(event.Message))
+	if err != nil {
+		return fmt.Errorf("Error building request to %s: invalid URL", redactURL(n.URL))
+	}
+	severity := eventSeverity(event)
+	priority, exists := n.Priorities[severity]
+	if !exists {
+		priority = defaultNtfyPriorities[severity]
+	}
+	title := event.Interface
+	if event.Device != "" {
+		title += " (" + event.Device + ")"
+	}
+	req.Header.Set("Title", title)
+	req.Header.Set("Priority", priority)
+	req.Header.Set("Tags", ntfyTags[severity])
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+
+	return sendNotification(req)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oauth2ExpiryMargin renews tokens slightly before they expire so a push
+// never races the expiry.
+const oauth2ExpiryMargin = time.Minute
+
+// OAuth2TokenSource fetches and caches access tokens using the OAuth2 client
+// credentials grant.
+type OAuth2TokenSource struct {
+	TokenURL         string
+	ClientID         string
+	ClientSecret     string
+	ClientSecretFile string
+	Scopes           []string
+	TLSConfig        *tls.Config
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// Token returns a cached access token, requesting a new one when it is about
+// to expire.
+func (s *OAuth2TokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Now().Add(oauth2ExpiryMargin).Before(s.expires) {
+		return s.token, nil
+	}
+
+	secret, err := resolveSecret(s.ClientSecret, s.ClientSecretFile)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(s.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.Scopes, " "))
+	}
+
+	req, err := http.NewRequest("POST", s.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(s.ClientID), url.QueryEscape(secret))
+
+	// The token endpoint is reached the same way as the push URL.
+	client := &http.Client{Timeout: 30 * time.Second, Transport: &http.Transport{Proxy: pushProxy, TLSClientConfig: s.TLSConfig}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Error requesting OAuth2 token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("OAuth2 token endpoint returned HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("Error unmarshalling OAuth2 token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("OAuth2 token endpoint returned no access token")
+	}
+
+	s.token = token.AccessToken
+	// Tokens without an expiry are refreshed hourly to be safe.
+	s.expires = time.Now().Add(time.Hour)
+	if token.ExpiresIn > 0 {
+		s.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return s.token, nil
+}
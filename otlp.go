@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// The types below mirror the OTLP/HTTP JSON encoding of the metrics protocol,
+// limited to what the monitor produces.
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	TimeUnixNano string         `json:"timeUnixNano"`
+	AsDouble     float64        `json:"asDouble"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+const otlpCumulativeTemporality = 2
+
+// otlpResourceLabels are lifted from the data points into the resource, so
+// each tether device shows up as its own resource next to the router's.
+var otlpResourceLabels = map[string]string{
+	"device":    "tether.device",
+	"interface": "tether.interface",
+}
+
+func toOTLP(timeSeriesList []promremote.TimeSeries) map[string][]otlpResourceMetrics {
+	hostname, _ := os.Hostname()
+
+	var resources []otlpResourceMetrics
+	resourceIndex := make(map[string]int)
+	metricIndex := make(map[string]int)
+
+	for _, ts := range timeSeriesList {
+		var name string
+		var resourceAttrs, pointAttrs []otlpKeyValue
+		resourceKey := ""
+		for _, label := range ts.Labels {
+			switch {
+			case label.Name == "__name__":
+				name = label.Value
+			case otlpResourceLabels[label.Name] != "":
+				resourceAttrs = append(resourceAttrs, otlpKeyValue{Key: otlpResourceLabels[label.Name], Value: otlpAnyValue{StringValue: label.Value}})
+				resourceKey += label.Name + "=" + label.Value + ","
+			default:
+				pointAttrs = append(pointAttrs, otlpKeyValue{Key: label.Name, Value: otlpAnyValue{StringValue: label.Value}})
+			}
+		}
+
+		i, exists := resourceIndex[resourceKey]
+		if !exists {
+			resources = append(resources, otlpResourceMetrics{
+				Resource: otlpResource{Attributes: append([]otlpKeyValue{
+					{Key: "service.name", Value: otlpAnyValue{StringValue: "tether-router-monitor"}},
+					{Key: "host.name", Value: otlpAnyValue{StringValue: hostname}},
+				}, resourceAttrs...)},
+				ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: "tether-router-monitor"}}},
+			})
+			i = len(resources) - 1
+			resourceIndex[resourceKey] = i
+		}
+		scope := &resources[i].ScopeMetrics[0]
+
+		point := otlpDataPoint{
+			Attributes:   pointAttrs,
+			TimeUnixNano: strconv.FormatInt(ts.Datapoint.Timestamp.UnixNano(), 10),
+			AsDouble:     ts.Datapoint.Value,
+		}
+
+		key := resourceKey + "|" + name
+		j, exists := metricIndex[key]
+		if !exists {
+			metric := otlpMetric{Name: name}
+			if strings.HasSuffix(name, "_total") {
+				metric.Sum = &otlpSum{AggregationTemporality: otlpCumulativeTemporality, IsMonotonic: true}
+			} else {
+				metric.Gauge = &otlpGauge{}
+			}
+			scope.Metrics = append(scope.Metrics, metric)
+			j = len(scope.Metrics) - 1
+			metricIndex[key] = j
+		}
+
+		if metric := &scope.Metrics[j]; metric.Sum != nil {
+			metric.Sum.DataPoints = append(metric.Sum.DataPoints, point)
+		} else {
+			metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, point)
+		}
+	}
+
+	return map[string][]otlpResourceMetrics{"resourceMetrics": resources}
+}
+
+// writeOTLP exports time series to an OpenTelemetry collector over OTLP/HTTP
+// using the JSON encoding.
+func writeOTLP(timeSeriesList []promremote.TimeSeries) error {
+	if len(timeSeriesList) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(toOTLP(timeSeriesList))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(otlpEndpoint, "/")+"/v1/metrics", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range otlpHeaders {
+		req.Header.Set(name, value)
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// PhoneBattery is the battery state reported by a tethered Android phone.
+type PhoneBattery struct {
+	Level       float64 // percent
+	Temperature float64 // degrees Celsius
+	Charging    bool
+}
+
+func executeADBCommand(serial string, args ...string) ([]byte, error) {
+	output, err := executeShellCommand("adb", append([]string{"-s", serial}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("Error executing adb %s on %s: %w", strings.Join(args, " "), serial, err)
+	}
+	return output, nil
+}
+
+func getPhoneBattery(serial string) (PhoneBattery, error) {
+	output, err := executeADBCommand(serial, "shell", "dumpsys", "battery")
+	if err != nil {
+		return PhoneBattery{}, err
+	}
+	return parseDumpsysBattery(string(output)), nil
+}
+
+func parseDumpsysBattery(output string) PhoneBattery {
+	var battery PhoneBattery
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "level":
+			battery.Level, _ = strconv.ParseFloat(value, 64)
+		case "temperature":
+			// Reported in tenths of a degree.
+			tenths, _ := strconv.ParseFloat(value, 64)
+			battery.Temperature = tenths / 10
+		case "status":
+			// A tethered phone is always USB powered, so only the
+			// BatteryManager status tells whether it keeps up: 2 is
+			// charging, 5 full. Anything else is draining.
+			battery.Charging = value == "2" || value == "5"
+		}
+	}
+	return battery
+}
+
+// +CBC: <bcs>,<bcl>
+var cbcRegex = regexp.MustCompile(`^\+CBC:\s*(\d+),\s*(\d+)`)
+
+// getBattery reads the battery state of a tethered phone over adb or, for
+// phones in PHONE_DEVICES that expose an AT port, with AT+CBC. USB modems
+// answer AT+CBC too, with the supply voltage as a level, so other AT ports
+// aren't asked. AT+CBC reports no temperature and only distinguishes
+// running on battery from being powered externally.
+func getBattery(modem Modem) (PhoneBattery, error) {
+	if modem.ADBSerial != "" {
+		return getPhoneBattery(modem.ADBSerial)
+	}
+
+	if modem.ATPort != "" && modem.Phone {
+		lines, err := executeATCommand(modem.ATPort, "AT+CBC")
+		if err != nil {
+			return PhoneBattery{}, err
+		}
+		for _, line := range lines {
+			matches := cbcRegex.FindStringSubmatch(line)
+			if matches == nil {
+				continue
+			}
+			// 2 means there is no battery, as on USB modems.
+			if matches[1] == "2" {
+				return PhoneBattery{}, errNoModem
+			}
+			level, _ := strconv.ParseFloat(matches[2], 64)
+			return PhoneBattery{Level: level, Charging: matches[1] == "1"}, nil
+		}
+		return PhoneBattery{}, fmt.Errorf("unexpected AT+CBC response: %q", lines)
+	}
+
+	return PhoneBattery{}, errNoModem
+}
+
+// collectPhoneBattery exports the battery level and charging state of a
+// tethered phone. A phone that ran flat overnight because it came loose
+// from its charger is the most common cause of a tether going offline.
+func collectPhoneBattery(modem Modem, labels []promremote.Label, now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("battery", time.Now())
+
+	battery, err := getBattery(modem)
+	if err != nil {
+		if err != errNoModem {
+			collectorLog.Warn("Error getting phone battery", "interface", labelValue(labels, "interface"), "err", err)
+		}
+		return nil, err == errNoModem
+	}
+	charging := 0.0
+	if battery.Charging {
+		charging = 1.0
+	}
+	return []promremote.TimeSeries{
+		newTimeSeries("tether_phone_battery_percent", battery.Level, now, labels),
+		newTimeSeries("tether_phone_battery_charging", charging, now, labels),
+	}, true
+}
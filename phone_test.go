@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDumpsysBattery(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   PhoneBattery
+	}{
+		{
+			name: "charging over usb",
+			output: `Current Battery Service state:
+  AC powered: false
+  USB powered: true
+  Wireless powered: false
+  Max charging current: 500000
+  Max charging voltage: 5000000
+  Charge counter: 2795000
+  status: 2
+  health: 2
+  present: true
+  level: 64
+  scale: 100
+  voltage: 4012
+  temperature: 281
+  technology: Li-ion
+`,
+			want: PhoneBattery{Level: 64, Temperature: 28.1, Charging: true},
+		},
+		{
+			name: "draining while usb powered",
+			output: `Current Battery Service state:
+  AC powered: false
+  USB powered: true
+  Wireless powered: false
+  Max charging current: 0
+  Max charging voltage: 0
+  Charge counter: 1203000
+  status: 3
+  health: 2
+  present: true
+  level: 27
+  scale: 100
+  voltage: 3712
+  temperature: 335
+  technology: Li-ion
+`,
+			want: PhoneBattery{Level: 27, Temperature: 33.5},
+		},
+		{
+			name: "full",
+			output: `Current Battery Service state:
+  AC powered: true
+  USB powered: false
+  Wireless powered: false
+  status: 5
+  level: 100
+  temperature: 300
+`,
+			want: PhoneBattery{Level: 100, Temperature: 30, Charging: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseDumpsysBattery(test.output); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseDumpsysBattery() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetBatterySkipsModemATPorts(t *testing.T) {
+	runner := &FakeRunner{}
+	defer func(previous CommandRunner) { commandRunner = previous }(commandRunner)
+	commandRunner = runner
+
+	if _, err := getBattery(Modem{ATPort: "/dev/ttyUSB2"}); err != errNoModem {
+		t.Errorf("getBattery() error = %v, want errNoModem", err)
+	}
+	if len(runner.Calls) > 0 {
+		t.Errorf("getBattery() ran %v for a modem AT port", runner.Calls)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// ProbeResult summarizes an ICMP probe sent out of a single interface.
+type ProbeResult struct {
+	Sent     int
+	Received int
+	MinRTT   time.Duration
+	AvgRTT   time.Duration
+	MaxRTT   time.Duration
+	RTTs     []time.Duration // individual replies, in arrival order
+}
+
+// LossRatio is the fraction of probes that went unanswered.
+func (r ProbeResult) LossRatio() float64 {
+	if r.Sent == 0 {
+		return 0
+	}
+	return 1 - float64(r.Received)/float64(r.Sent)
+}
+
+// Jitter is the mean absolute difference between consecutive RTTs.
+func (r ProbeResult) Jitter() time.Duration {
+	if len(r.RTTs) < 2 {
+		return 0
+	}
+	var total time.Duration
+	for i := 1; i < len(r.RTTs); i++ {
+		delta := r.RTTs[i] - r.RTTs[i-1]
+		if delta < 0 {
+			delta = -delta
+		}
+		total += delta
+	}
+	return total / time.Duration(len(r.RTTs)-1)
+}
+
+var (
+	pingPacketsRegex = regexp.MustCompile(`(\d+) packets transmitted, (\d+) (?:packets )?received`)
+	// Busybox prints "round-trip min/avg/max", iputils "rtt min/avg/max/mdev".
+	pingRTTRegex   = regexp.MustCompile(`min/avg/max(?:/mdev)? = ([\d.]+)/([\d.]+)/([\d.]+)`)
+	pingReplyRegex = regexp.MustCompile(`time=([\d.]+) ms`)
+)
+
+// probeInterface pings target bound to device so the probe leaves through
+// that tether regardless of the routing policy.
+func probeInterface(device, target string) (ProbeResult, error) {
+	args := []string{
+		"-c", strconv.Itoa(probeCount),
+		"-W", strconv.Itoa(probeTimeoutSeconds),
+		"-I", device,
+	}
+	// A short interval sends the probes as a burst, which is what loss and
+	// jitter measurements need.
+	if probeInterval != "" {
+		args = append(args, "-i", probeInterval)
+	}
+	output, err := executeShellCommand("ping", append(args, target)...)
+	// ping exits non-zero when no reply arrived; the summary is still valid.
+	result, parseErr := parsePingOutput(string(output))
+	if parseErr != nil {
+		if err != nil {
+			return result, fmt.Errorf("Error executing ping via %s: %w", device, err)
+		}
+		return result, parseErr
+	}
+	return result, nil
+}
+
+func parsePingOutput(output string) (ProbeResult, error) {
+	var result ProbeResult
+
+	matches := pingPacketsRegex.FindStringSubmatch(output)
+	if len(matches) != 3 {
+		return result, fmt.Errorf("unexpected ping output: %q", strings.TrimSpace(output))
+	}
+	result.Sent, _ = strconv.Atoi(matches[1])
+	result.Received, _ = strconv.Atoi(matches[2])
+
+	if matches := pingRTTRegex.FindStringSubmatch(output); len(matches) == 4 {
+		result.MinRTT = parseMilliseconds(matches[1])
+		result.AvgRTT = parseMilliseconds(matches[2])
+		result.MaxRTT = parseMilliseconds(matches[3])
+	}
+
+	for _, matches := range pingReplyRegex.FindAllStringSubmatch(output, -1) {
+		result.RTTs = append(result.RTTs, parseMilliseconds(matches[1]))
+	}
+	return result, nil
+}
+
+func parseMilliseconds(value string) time.Duration {
+	ms, _ := strconv.ParseFloat(value, 64)
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+var (
+	// probeFailureStreaks counts the consecutive failed probes per interface.
+	probeFailureStreaks = make(map[string]int)
+	// probeLastSuccess keeps when a probe of each interface last got
+	// through. Cached cycles don't probe and leave it alone.
+	probeLastSuccess = make(map[string]time.Time)
+)
+
+func collectProbe(device string, labels []promremote.Label, now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("probe", time.Now())
+
+	labels = append(labels, promremote.Label{Name: "target", Value: probeTarget})
+
+	result, err := probeInterface(device, probeTarget)
+	iface := labelValue(labels, "interface")
+	if err != nil || result.Received == 0 {
+		probeFailureStreaks[iface]++
+	} else {
+		probeFailureStreaks[iface] = 0
+		probeLastSuccess[iface] = time.Now()
+	}
+	if err != nil {
+		return []promremote.TimeSeries{
+			newTimeSeries("tether_probe_success", 0, now, labels),
+			newTimeSeries("tether_probe_loss_ratio", 1, now, labels),
+		}, true
+	}
+
+	success := 0.0
+	if result.Received > 0 {
+		success = 1.0
+	}
+	timeSeriesList := []promremote.TimeSeries{
+		newTimeSeries("tether_probe_success", success, now, labels),
+		newTimeSeries("tether_probe_loss_ratio", result.LossRatio(), now, labels),
+	}
+	if result.Received > 0 {
+		timeSeriesList = append(timeSeriesList,
+			newTimeSeries("tether_probe_rtt_min_seconds", result.MinRTT.Seconds(), now, labels),
+			newTimeSeries("tether_probe_rtt_avg_seconds", result.AvgRTT.Seconds(), now, labels),
+			newTimeSeries("tether_probe_rtt_max_seconds", result.MaxRTT.Seconds(), now, labels),
+		)
+	}
+	if len(result.RTTs) > 1 {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_probe_jitter_seconds", result.Jitter().Seconds(), now, labels))
+	}
+
+	histogram := probeRTTHistograms.observe(device+"/"+probeTarget, result.RTTs)
+	timeSeriesList = append(timeSeriesList, histogram.timeSeries("tether_probe_rtt_seconds", labels, now)...)
+	return timeSeriesList, true
+}
+
+// Histogram is a cumulative classic Prometheus histogram.
+type Histogram struct {
+	bounds []float64
+	counts []uint64 // per bucket, not cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *Histogram) observe(value float64) {
+	i := sort.SearchFloat64s(h.bounds, value)
+	h.counts[i]++
+	h.sum += value
+	h.count++
+}
+
+// timeSeries returns the _bucket, _sum and _count series of the histogram.
+func (h *Histogram) timeSeries(name string, labels []promremote.Label, now time.Time) []promremote.TimeSeries {
+	var timeSeriesList []promremote.TimeSeries
+	var cumulative uint64
+	for i, count := range h.counts {
+		cumulative += count
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = strconv.FormatFloat(h.bounds[i], 'g', -1, 64)
+		}
+		timeSeriesList = append(timeSeriesList, newTimeSeries(name+"_bucket", float64(cumulative), now, append(labels, promremote.Label{Name: "le", Value: le})))
+	}
+	return append(timeSeriesList,
+		newTimeSeries(name+"_sum", h.sum, now, labels),
+		newTimeSeries(name+"_count", float64(h.count), now, labels),
+	)
+}
+
+// ProbeHistograms accumulates the individual probe RTTs of every interface
+// since the monitor started, so percentiles can be computed server-side
+// with histogram_quantile over any time range.
+type ProbeHistograms struct {
+	histograms map[string]*Histogram
+}
+
+var probeRTTHistograms = &ProbeHistograms{
+	histograms: make(map[string]*Histogram),
+}
+
+func (p *ProbeHistograms) observe(key string, rtts []time.Duration) *Histogram {
+	histogram, exists := p.histograms[key]
+	if !exists {
+		histogram = newHistogram(probeRTTBuckets)
+		p.histograms[key] = histogram
+	}
+	for _, rtt := range rtts {
+		histogram.observe(rtt.Seconds())
+	}
+	return histogram
+}
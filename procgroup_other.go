@@ -0,0 +1,9 @@
+//go:build windows || plan9
+
+package main
+
+import "os/exec"
+
+// killProcessGroupOnCancel leaves the default of killing only the command
+// itself, as there are no process groups to signal.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+var promLabelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// toPrometheusText renders time series in the Prometheus text exposition
+// format. Timestamps are omitted; consumers stamp samples when they scrape.
+func toPrometheusText(timeSeriesList []promremote.TimeSeries) []byte {
+	type line struct {
+		name   string
+		labels string
+		value  float64
+	}
+
+	var lines []line
+	for _, ts := range timeSeriesList {
+		var name string
+		var labels []string
+		for _, label := range ts.Labels {
+			if label.Name == "__name__" {
+				name = label.Value
+			} else if label.Value != "" {
+				labels = append(labels, label.Name+`="`+promLabelValueEscaper.Replace(label.Value)+`"`)
+			}
+		}
+		lines = append(lines, line{name: name, labels: strings.Join(labels, ","), value: ts.Datapoint.Value})
+	}
+
+	// All samples of a metric family must be grouped under one TYPE line.
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].name < lines[j].name })
+
+	var buf bytes.Buffer
+	for i, l := range lines {
+		if i == 0 || lines[i-1].name != l.name {
+			metricType := "gauge"
+			if strings.HasSuffix(l.name, "_total") {
+				metricType = "counter"
+			}
+			buf.WriteString("# TYPE " + l.name + " " + metricType + "\n")
+		}
+		buf.WriteString(l.name)
+		if l.labels != "" {
+			buf.WriteString("{" + l.labels + "}")
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatFloat(l.value, 'g', -1, 64))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// printDryRun writes a cycle's series to stdout in the text format and a
+// cardinality summary to stderr.
+func printDryRun(cycle Cycle) error {
+	if _, err := os.Stdout.Write(toPrometheusText(cycle.TimeSeries)); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for _, ts := range cycle.TimeSeries {
+		names[labelValue(ts.Labels, "__name__")] = true
+	}
+	fmt.Fprintf(os.Stderr, "# %d series across %d metric names\n", len(cycle.TimeSeries), len(names))
+	return nil
+}
+
+// writeTextfile writes the series for node_exporter's textfile collector.
+// The file is replaced atomically so a scrape never sees it half written;
+// the temporary file has to be in the same directory for the rename.
+func writeTextfile(path string, timeSeriesList []promremote.TimeSeries) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, toPrometheusText(timeSeriesList), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
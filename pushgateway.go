@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// writePushgateway replaces this router's group on a Prometheus Pushgateway.
+// The grouping key is the job plus the router's instance label, so each
+// router owns its own group and stale series disappear on the next push.
+func writePushgateway(timeSeriesList []promremote.TimeSeries) error {
+	endpoint := strings.TrimSuffix(pushgatewayURL, "/") +
+		"/metrics/job/" + url.PathEscape(pushgatewayJob) +
+		"/instance/" + url.PathEscape(instance)
+
+	req, err := http.NewRequest("PUT", endpoint, bytes.NewReader(toPrometheusText(timeSeriesList)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	for name, value := range pushgatewayHeaders {
+		req.Header.Set(name, value)
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
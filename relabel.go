@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// RelabelRule is a subset of Prometheus' relabel_config. Rules are read from
+// a JSON file and applied in order to every series before it is written.
+type RelabelRule struct {
+	SourceLabels []string `json:"source_labels"`
+	Separator    *string  `json:"separator"`
+	Regex        *string  `json:"regex"`
+	TargetLabel  string   `json:"target_label"`
+	Replacement  *string  `json:"replacement"`
+	Action       string   `json:"action"`
+
+	regex *regexp.Regexp
+}
+
+func loadRelabelRules(path string) ([]RelabelRule, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading relabel config: %w", err)
+	}
+	var rules []RelabelRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling relabel config: %w", err)
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Action == "" {
+			rule.Action = "replace"
+		}
+		if rule.Separator == nil {
+			separator := ";"
+			rule.Separator = &separator
+		}
+		if rule.Replacement == nil {
+			replacement := "$1"
+			rule.Replacement = &replacement
+		}
+		pattern := "(.*)"
+		if rule.Regex != nil {
+			pattern = *rule.Regex
+		}
+		// Like Prometheus, the regex has to match the whole value.
+		rule.regex, err = regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("relabel rule %d: invalid regex: %w", i, err)
+		}
+
+		switch rule.Action {
+		case "replace":
+			if rule.TargetLabel == "" {
+				return nil, fmt.Errorf("relabel rule %d: replace requires target_label", i)
+			}
+		case "keep", "drop", "labeldrop", "labelkeep":
+		default:
+			return nil, fmt.Errorf("relabel rule %d: unknown action %q", i, rule.Action)
+		}
+	}
+	return rules, nil
+}
+
+// relabel applies the rules to every series and returns the ones that are
+// kept. Series whose __name__ ends up empty are dropped as well.
+func relabel(timeSeriesList []promremote.TimeSeries, rules []RelabelRule) []promremote.TimeSeries {
+	if len(rules) == 0 {
+		return timeSeriesList
+	}
+
+	kept := timeSeriesList[:0]
+	for _, ts := range timeSeriesList {
+		labels, keep := applyRelabelRules(ts.Labels, rules)
+		if !keep || labelValue(labels, "__name__") == "" {
+			continue
+		}
+		ts.Labels = labels
+		kept = append(kept, ts)
+	}
+	return kept
+}
+
+func applyRelabelRules(labels []promremote.Label, rules []RelabelRule) ([]promremote.Label, bool) {
+	for _, rule := range rules {
+		values := make([]string, len(rule.SourceLabels))
+		for i, name := range rule.SourceLabels {
+			values[i] = labelValue(labels, name)
+		}
+		value := strings.Join(values, *rule.Separator)
+
+		switch rule.Action {
+		case "keep":
+			if !rule.regex.MatchString(value) {
+				return nil, false
+			}
+		case "drop":
+			if rule.regex.MatchString(value) {
+				return nil, false
+			}
+		case "replace":
+			match := rule.regex.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+			result := string(rule.regex.ExpandString(nil, *rule.Replacement, value, match))
+			labels = setLabel(labels, rule.TargetLabel, result)
+		case "labeldrop", "labelkeep":
+			filtered := make([]promremote.Label, 0, len(labels))
+			for _, label := range labels {
+				matches := rule.regex.MatchString(label.Name)
+				if label.Name == "__name__" || matches == (rule.Action == "labelkeep") {
+					filtered = append(filtered, label)
+				}
+			}
+			labels = filtered
+		}
+	}
+	return labels, true
+}
+
+// setLabel returns a copy of labels with name set to value. An empty value
+// removes the label, as in Prometheus.
+func setLabel(labels []promremote.Label, name, value string) []promremote.Label {
+	result := make([]promremote.Label, 0, len(labels)+1)
+	for _, label := range labels {
+		if label.Name != name {
+			result = append(result, label)
+		}
+	}
+	if value != "" {
+		result = append(result, promremote.Label{Name: name, Value: value})
+	}
+	return result
+}
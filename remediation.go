@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// usbDeauthorizeDelay is how long a device stays deauthorized during a
+// sysfs power cycle, long enough for phones to notice the disconnect.
+const usbDeauthorizeDelay = 3 * time.Second
+
+var (
+	offlineStreaks = make(map[string]int)
+	remediations   = make(map[string]int)
+)
+
+// powerCycleUSB resets the USB device behind a network interface, either by
+// toggling its sysfs authorized flag or by cutting port power with uhubctl.
+func powerCycleUSB(device string) error {
+	path, err := usbDevicePath(device)
+	if err != nil {
+		return err
+	}
+
+	if remediationMethod == "uhubctl" {
+		location, port, err := usbHubPort(filepath.Base(path))
+		if err != nil {
+			return err
+		}
+		if _, err := executeShellCommand("uhubctl", "-l", location, "-p", port, "-a", "cycle"); err != nil {
+			return fmt.Errorf("Error executing uhubctl for %s: %w", device, err)
+		}
+		return nil
+	}
+
+	authorized := filepath.Join(path, "authorized")
+	if err := os.WriteFile(authorized, []byte("0"), 0644); err != nil {
+		return fmt.Errorf("Error deauthorizing %s: %w", device, err)
+	}
+	time.Sleep(usbDeauthorizeDelay)
+	if err := os.WriteFile(authorized, []byte("1"), 0644); err != nil {
+		return fmt.Errorf("Error reauthorizing %s: %w", device, err)
+	}
+	return nil
+}
+
+// usbHubPort splits a sysfs USB device name such as "1-1.4" into the hub
+// location ("1-1") and port ("4") uhubctl expects.
+func usbHubPort(name string) (string, string, error) {
+	if i := strings.LastIndex(name, "."); i > 0 {
+		return name[:i], name[i+1:], nil
+	}
+	if i := strings.LastIndex(name, "-"); i > 0 {
+		return name[:i], name[i+1:], nil
+	}
+	return "", "", fmt.Errorf("unexpected USB device name %q", name)
+}
+
+// remediate power-cycles a device once it has been offline for the
+// configured number of consecutive intervals.
+func remediate(data CombinedData, labels []promremote.Label, now time.Time) []promremote.TimeSeries {
+	if data.Status == "online" || data.Status == "disabled" {
+		offlineStreaks[data.Interface] = 0
+	} else {
+		offlineStreaks[data.Interface]++
+	}
+
+	if offlineStreaks[data.Interface] >= remediationOfflineIntervals {
+		offlineStreaks[data.Interface] = 0
+		remediationLog.Info("Interface offline, power-cycling device", "interface", data.Interface, "device", data.Device, "intervals", remediationOfflineIntervals)
+		if err := powerCycleUSB(data.Device); err != nil {
+			remediationLog.Error("Error power-cycling device", "interface", data.Interface, "device", data.Device, "err", err)
+		} else {
+			remediations[data.Interface]++
+		}
+	}
+
+	return []promremote.TimeSeries{
+		newTimeSeries("tether_remediations_total", float64(remediations[data.Interface]), now, append(labels,
+			promremote.Label{Name: "method", Value: remediationMethod},
+		)),
+	}
+}
+
+var (
+	offlineSince   = make(map[string]time.Time)
+	lastRestarts   = make(map[string]time.Time)
+	restartActions = make(map[string]int)
+)
+
+// restartInterface runs the configured restart action once an interface has
+// been offline longer than the threshold. A cool-down per restart target keeps
+// a permanently dead tether from restarting mwan3 every interval.
+func restartInterface(data CombinedData, labels []promremote.Label, now time.Time) []promremote.TimeSeries {
+	if data.Status == "online" || data.Status == "disabled" {
+		delete(offlineSince, data.Interface)
+	} else if _, exists := offlineSince[data.Interface]; !exists {
+		offlineSince[data.Interface] = now
+	}
+
+	// mwan3 restart affects every interface, so it shares one cool-down.
+	target := data.Interface
+	if restartAction == "mwan3" {
+		target = "mwan3"
+	}
+
+	since, offline := offlineSince[data.Interface]
+	if offline && now.Sub(since) >= restartOfflineThreshold && now.Sub(lastRestarts[target]) >= restartCooldown {
+		lastRestarts[target] = now
+
+		var err error
+		if restartAction == "mwan3" {
+			remediationLog.Info("Interface offline, restarting mwan3", "interface", data.Interface, "offline_since", since)
+			_, err = executeShellCommand("mwan3", "restart")
+		} else {
+			remediationLog.Info("Interface offline, running ifup", "interface", data.Interface, "offline_since", since)
+			_, err = executeShellCommand("ifup", data.Interface)
+		}
+		if err != nil {
+			remediationLog.Error("Error running restart action", "action", restartAction, "interface", data.Interface, "err", err)
+		} else {
+			restartActions[data.Interface]++
+		}
+	}
+
+	return []promremote.TimeSeries{
+		newTimeSeries("tether_restart_actions_total", float64(restartActions[data.Interface]), now, append(labels,
+			promremote.Label{Name: "action", Value: restartAction},
+		)),
+	}
+}
+
+var (
+	watchdogReconnected = make(map[string]time.Time)
+	watchdogAttempts    = make(map[string]int)
+	watchdogSuccesses   = make(map[string]int)
+)
+
+// reconnectModem makes the modem drop and re-establish its network
+// registration: a network restart over QMI, an airplane mode cycle over AT.
+func reconnectModem(modem Modem) error {
+	if modem.QMIDevice != "" {
+		if _, err := executeQMICommand(modem.QMIDevice, "--network-deregister"); err != nil {
+			return err
+		}
+		_, err := executeQMICommand(modem.QMIDevice, "--network-register")
+		return err
+	}
+
+	if modem.ATPort != "" {
+		if _, err := executeATCommand(modem.ATPort, "AT+CFUN=0"); err != nil {
+			return err
+		}
+		_, err := executeATCommand(modem.ATPort, "AT+CFUN=1")
+		return err
+	}
+
+	return errNoModem
+}
+
+// modemWatchdog reconnects the modem once the configured number of
+// consecutive probes failed. A reconnect counts as successful once a probe
+// run after it gets through.
+func modemWatchdog(modem Modem, data CombinedData, labels []promremote.Label, now time.Time) []promremote.TimeSeries {
+	streak := probeFailureStreaks[data.Interface]
+	if reconnected, pending := watchdogReconnected[data.Interface]; pending && probeLastSuccess[data.Interface].After(reconnected) {
+		delete(watchdogReconnected, data.Interface)
+		watchdogSuccesses[data.Interface]++
+	}
+
+	if streak >= modemWatchdogFailedProbes {
+		// Require a full streak of failures again before the next attempt.
+		probeFailureStreaks[data.Interface] = 0
+		remediationLog.Info("Probes failing, reconnecting modem", "interface", data.Interface, "device", data.Device, "failed_probes", streak)
+		watchdogAttempts[data.Interface]++
+		if err := reconnectModem(modem); err != nil {
+			remediationLog.Error("Error reconnecting modem", "interface", data.Interface, "device", data.Device, "err", err)
+		} else {
+			watchdogReconnected[data.Interface] = time.Now()
+		}
+	}
+
+	return []promremote.TimeSeries{
+		newTimeSeries("tether_modem_reconnect_attempts_total", float64(watchdogAttempts[data.Interface]), now, labels),
+		newTimeSeries("tether_modem_reconnect_successes_total", float64(watchdogSuccesses[data.Interface]), now, labels),
+	}
+}
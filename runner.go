@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CommandRunner runs an external command and returns its stdout. Every
+// collector goes through commandRunner, so swapping it replaces the router
+// for the whole cycle. The one exception is the mwan3 event watcher: it
+// streams logread -f for the life of the process rather than taking one
+// output, so it runs logread directly and is not started under fixtures.
+// AT commands are sent over serial ports rather than run; they go through
+// atPorts instead.
+type CommandRunner interface {
+	Run(ctx context.Context, command string, args ...string) ([]byte, error)
+}
+
+var commandRunner CommandRunner = ExecRunner{}
+
+// ExecRunner runs commands on the local system.
+type ExecRunner struct{}
+
+func (ExecRunner) Run(ctx context.Context, command string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, command, args...)
+	killProcessGroupOnCancel(cmd)
+	// Don't wait forever for grandchildren still holding stdout open.
+	cmd.WaitDelay = time.Second
+	return cmd.Output()
+}
+
+// FakeRunner answers commands with canned outputs keyed by the command line,
+// such as "ifusb usb0", and records the commands it was asked to run.
+// Commands without an output fail like a missing executable.
+type FakeRunner struct {
+	mu      sync.Mutex
+	Outputs map[string][]byte
+	Errors  map[string]error
+	Calls   []string
+}
+
+func (r *FakeRunner) Run(ctx context.Context, command string, args ...string) ([]byte, error) {
+	commandLine := strings.Join(append([]string{command}, args...), " ")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Calls = append(r.Calls, commandLine)
+	if err := r.Errors[commandLine]; err != nil {
+		return r.Outputs[commandLine], err
+	}
+	if output, exists := r.Outputs[commandLine]; exists {
+		return output, nil
+	}
+	return nil, fmt.Errorf("exec: %q: %w", command, exec.ErrNotFound)
+}
+
+// FakeATPorts answers AT commands with canned responses keyed by the
+// command, such as "AT+CBC", and records the commands it was sent on any
+// port. Commands without a response get no answer, so they time out.
+type FakeATPorts struct {
+	mu        sync.Mutex
+	Responses map[string]string
+	Calls     []string
+}
+
+func (p *FakeATPorts) Open(port string) (ATConn, error) {
+	return &fakeATConn{ports: p}, nil
+}
+
+type fakeATConn struct {
+	ports    *FakeATPorts
+	response strings.Reader
+}
+
+func (c *fakeATConn) Write(data []byte) (int, error) {
+	command := strings.TrimSpace(string(data))
+
+	c.ports.mu.Lock()
+	defer c.ports.mu.Unlock()
+	c.ports.Calls = append(c.ports.Calls, command)
+	c.response.Reset(c.ports.Responses[command])
+	return len(data), nil
+}
+
+func (c *fakeATConn) Read(data []byte) (int, error) {
+	if c.response.Len() == 0 {
+		return 0, os.ErrDeadlineExceeded
+	}
+	return c.response.Read(data)
+}
+
+func (c *fakeATConn) SetReadDeadline(t time.Time) error { return nil }
+
+func (c *fakeATConn) Close() error { return nil }
+
+// fixtureCounterRegex matches the byte and packet counters of ifconfig and
+// ip -s link output.
+var fixtureCounterRegex = regexp.MustCompile(`((?:bytes|packets)"?[: ]\s*)(\d+)`)
+
+// FixtureRunner replays command outputs stored in a directory, one file per
+// command line with spaces replaced by underscores (ifdev, mwan3ifstatus,
+// ifconfig, ifusb_usb0). Numbered variants such as mwan3ifstatus.1 and
+// mwan3ifstatus.2 are returned in turn, so a fixture can loop through
+// outages. With mutate, traffic counters grow on every replay.
+type FixtureRunner struct {
+	dir    string
+	mutate bool
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func newFixtureRunner(dir string, mutate bool) *FixtureRunner {
+	return &FixtureRunner{dir: dir, mutate: mutate, calls: make(map[string]int)}
+}
+
+func (r *FixtureRunner) Run(ctx context.Context, command string, args ...string) ([]byte, error) {
+	name := strings.ReplaceAll(strings.Join(append([]string{command}, args...), "_"), "/", "_")
+
+	r.mu.Lock()
+	call := r.calls[name]
+	r.calls[name]++
+	r.mu.Unlock()
+
+	path := filepath.Join(r.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		variants, _ := filepath.Glob(path + ".*")
+		if len(variants) == 0 {
+			return nil, fmt.Errorf("exec: %q: no fixture %s: %w", command, name, exec.ErrNotFound)
+		}
+		sort.Strings(variants)
+		path = variants[call%len(variants)]
+	}
+
+	output, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if r.mutate {
+		output = fixtureCounterRegex.ReplaceAllFunc(output, func(match []byte) []byte {
+			parts := fixtureCounterRegex.FindSubmatch(match)
+			value, _ := strconv.ParseInt(string(parts[2]), 10, 64)
+			// Roughly a megabyte or a thousand packets per replay.
+			step := int64(1000)
+			if bytes.Contains(parts[1], []byte("bytes")) {
+				step = 1 << 20
+			}
+			return append(slices.Clone(parts[1]), strconv.FormatInt(value+int64(call)*step, 10)...)
+		})
+	}
+	return output, nil
+}
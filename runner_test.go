@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+const (
+	testIfdev         = `[{"interface":"lan","device":"br-lan"},{"interface":"wan_usb0","device":"usb0"}]`
+	testMwan3ifstatus = `[{"interface":"wan_usb0","status":"online","online_time":"1h:02m:03s","uptime":"1h:02m:10s","tracking":"active"}]`
+	testIfconfig      = `usb0      Link encap:Ethernet  HWaddr 02:00:00:00:00:01
+          RX packets:1000 errors:0 dropped:0 overruns:0 frame:0
+          TX packets:500 errors:0 dropped:0 overruns:0 carrier:0
+          RX bytes:123456 (120.5 KiB)  TX bytes:65432 (63.8 KiB)
+`
+	testIfusb = `{"bus":"001","device":"004","description":"Google Inc. Pixel 7 (tether)"}`
+)
+
+func TestMergeData(t *testing.T) {
+	ifdevData := []Ifdev{{Interface: "wan_usb0", Device: "usb0"}, {Interface: "wan_usb1", Device: "usb1"}}
+	mwan3Data := []Mwan3ifstatus{
+		{Interface: "wan_usb0", Status: "online", OnlineTime: "1h:02m:03s", Uptime: "1h:02m:10s", Tracking: "active"},
+		{Interface: "wan_usb1", Status: "offline", Tracking: "active"},
+		{Interface: "wan_usb2", Status: "online"},
+	}
+	traffic := map[string]NetworkTraffic{"usb0": {Interface: "usb0", RX: 100, TX: 200}}
+
+	want := []CombinedData{
+		{Interface: "wan_usb0", Device: "usb0", Status: "online", OnlineTime: "1h:02m:03s", Uptime: "1h:02m:10s", Tracking: "active", RX: 100, TX: 200},
+		{Interface: "wan_usb1", Device: "usb1", Status: "offline", Tracking: "active"},
+	}
+	if got := mergeData(ifdevData, mwan3Data, traffic); !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeData() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCollectWithFakeRunner(t *testing.T) {
+	runner := &FakeRunner{Outputs: map[string][]byte{
+		"ifdev":         []byte(testIfdev),
+		"mwan3ifstatus": []byte(testMwan3ifstatus),
+		"ifconfig":      []byte(testIfconfig),
+		"ifusb usb0":    []byte(testIfusb),
+	}}
+	defer func(previous CommandRunner, previousUsage *UsageTracker) {
+		commandRunner, usage = previous, previousUsage
+		collectorCache.invalidate("traffic", "")
+		collectorCache.invalidate("ifusb", "usb0")
+	}(commandRunner, usage)
+	commandRunner = runner
+	usage = newUsageTracker("")
+
+	cycle := collect()
+
+	want := []CombinedData{{
+		Interface:   "wan_usb0",
+		Device:      "usb0",
+		Description: "Google Inc. Pixel 7 (tether)",
+		Status:      "online",
+		OnlineTime:  "1h:02m:03s",
+		Uptime:      "1h:02m:10s",
+		Tracking:    "active",
+		RX:          123456,
+		TX:          65432,
+	}}
+	if !reflect.DeepEqual(cycle.Interfaces, want) {
+		t.Errorf("collect() interfaces = %+v, want %+v", cycle.Interfaces, want)
+	}
+	for _, command := range []string{"ifdev", "mwan3ifstatus", "ifconfig", "ifusb usb0"} {
+		if !slices.Contains(runner.Calls, command) {
+			t.Errorf("collect() didn't run %q, ran %v", command, runner.Calls)
+		}
+	}
+
+	var found bool
+	for _, ts := range cycle.TimeSeries {
+		if labelValue(ts.Labels, "__name__") == "tether_iface_status_online" && labelValue(ts.Labels, "interface") == "wan_usb0" {
+			found = true
+			if ts.Datapoint.Value != 1 {
+				t.Errorf("tether_iface_status_online = %v, want 1", ts.Datapoint.Value)
+			}
+		}
+	}
+	if !found {
+		t.Error("collect() didn't export tether_iface_status_online for wan_usb0")
+	}
+}
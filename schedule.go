@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron expression of five fields: minute, hour, day of month,
+// month and day of week (0 or 7 for Sunday). Fields take *, numbers, ranges
+// such as 1-5, steps such as */15 or 8-18/2, and comma-separated lists of
+// these. Like cron, a day matches when either day field matches if both are
+// restricted.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+var scheduleFieldBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+func parseSchedule(spec string) (*Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q must have five fields", spec)
+	}
+
+	var bits [5]uint64
+	for i, field := range fields {
+		for _, part := range strings.Split(field, ",") {
+			set, err := parseScheduleRange(part, scheduleFieldBounds[i][0], scheduleFieldBounds[i][1])
+			if err != nil {
+				return nil, fmt.Errorf("schedule %q: %w", spec, err)
+			}
+			bits[i] |= set
+		}
+	}
+	// Sunday is both 0 and 7.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &Schedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+func parseScheduleRange(part string, min, max int) (uint64, error) {
+	rangePart, stepPart, hasStep := strings.Cut(part, "/")
+	step := 1
+	if hasStep {
+		var err error
+		if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+			return 0, fmt.Errorf("invalid step in %q", part)
+		}
+	}
+
+	low, high := min, max
+	if rangePart != "*" {
+		first, last, isRange := strings.Cut(rangePart, "-")
+		var err error
+		if low, err = strconv.Atoi(first); err != nil {
+			return 0, fmt.Errorf("invalid value in %q", part)
+		}
+		high = low
+		if isRange {
+			if high, err = strconv.Atoi(last); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+		} else if hasStep {
+			high = max
+		}
+	}
+	if low < min || high > max || low > high {
+		return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+	}
+
+	var set uint64
+	for value := low; value <= high; value += step {
+		set |= 1 << value
+	}
+	return set, nil
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatches := s.dom&(1<<t.Day()) != 0
+	dowMatches := s.dow&(1<<t.Weekday()) != 0
+	if s.domAny || s.dowAny {
+		return domMatches && dowMatches
+	}
+	return domMatches || dowMatches
+}
+
+// next returns the first minute of the schedule after the given time, or
+// the zero time if there is none within five years, as with "0 0 30 2 *".
+func (s *Schedule) next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<t.Month()) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// resolveSecret returns the secret stored in path, or value when no file is
+// configured. The file is read on every call so rotated secrets are picked up
+// on the next push without restarting the monitor.
+func resolveSecret(value, path string) (string, error) {
+	if path == "" {
+		return value, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Error reading secret file %s: %w", path, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// SelfMetrics instruments the monitor itself so a wedged collector or a
+// failing output can be alerted on like any other metric.
+type SelfMetrics struct {
+	mu                 sync.Mutex
+	collectorDurations map[string]time.Duration
+	execFailures       map[string]int
+	pushDurations      map[string]time.Duration
+	pushErrors         map[string]int
+	samplesSent        map[string]int
+	samplesDropped     map[string]int
+	connections        map[bool]int
+	connectDuration    time.Duration
+	queueDepths        map[string]int
+}
+
+var selfMetrics = &SelfMetrics{
+	collectorDurations: make(map[string]time.Duration),
+	execFailures:       make(map[string]int),
+	pushDurations:      make(map[string]time.Duration),
+	pushErrors:         make(map[string]int),
+	samplesSent:        make(map[string]int),
+	samplesDropped:     make(map[string]int),
+	connections:        make(map[bool]int),
+	queueDepths:        make(map[string]int),
+}
+
+// observeCollector adds the time spent in a collector since start to the
+// current cycle. Use it as `defer observeCollector("name", time.Now())`.
+func observeCollector(collector string, start time.Time) {
+	selfMetrics.mu.Lock()
+	defer selfMetrics.mu.Unlock()
+	selfMetrics.collectorDurations[collector] += time.Since(start)
+}
+
+// resetCollectorDurations starts a new cycle; per-device collectors accumulate
+// their time across all devices within a cycle.
+func resetCollectorDurations() {
+	selfMetrics.mu.Lock()
+	defer selfMetrics.mu.Unlock()
+	selfMetrics.collectorDurations = make(map[string]time.Duration)
+}
+
+func observeExecFailure(command string) {
+	selfMetrics.mu.Lock()
+	defer selfMetrics.mu.Unlock()
+	selfMetrics.execFailures[command]++
+}
+
+func observePush(output string, duration time.Duration, samples int, err error) {
+	selfMetrics.mu.Lock()
+	defer selfMetrics.mu.Unlock()
+	selfMetrics.pushDurations[output] = duration
+	if err != nil {
+		selfMetrics.pushErrors[output]++
+		selfMetrics.samplesDropped[output] += samples
+	} else {
+		selfMetrics.samplesSent[output] += samples
+	}
+}
+
+// observeDroppedSamples counts samples an output lost outside of a push, such
+// as those evicted from a full buffer.
+func observeDroppedSamples(output string, samples int) {
+	selfMetrics.mu.Lock()
+	defer selfMetrics.mu.Unlock()
+	selfMetrics.samplesDropped[output] += samples
+}
+
+// observeRemoteWriteConnection records whether a remote write reused a
+// kept-alive connection and, for a new one, how long dialing took.
+func observeRemoteWriteConnection(reused bool, connectDuration time.Duration) {
+	selfMetrics.mu.Lock()
+	defer selfMetrics.mu.Unlock()
+	selfMetrics.connections[reused]++
+	if !reused {
+		selfMetrics.connectDuration = connectDuration
+	}
+}
+
+// observeQueueDepth records how many items a buffer held when it was last
+// drained.
+func observeQueueDepth(queue string, depth int) {
+	selfMetrics.mu.Lock()
+	defer selfMetrics.mu.Unlock()
+	selfMetrics.queueDepths[queue] = depth
+}
+
+func collectSelfMetrics(now time.Time) []promremote.TimeSeries {
+	selfMetrics.mu.Lock()
+	defer selfMetrics.mu.Unlock()
+
+	timeSeriesList := []promremote.TimeSeries{newTimeSeries("tether_monitor_up", 1, now, nil)}
+	for collector, duration := range selfMetrics.collectorDurations {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_monitor_collector_duration_seconds", duration.Seconds(), now, []promremote.Label{
+			{Name: "collector", Value: collector},
+		}))
+	}
+	for command, failures := range selfMetrics.execFailures {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_monitor_exec_failures_total", float64(failures), now, []promremote.Label{
+			{Name: "command", Value: command},
+		}))
+	}
+	for output, duration := range selfMetrics.pushDurations {
+		labels := []promremote.Label{{Name: "output", Value: output}}
+		timeSeriesList = append(timeSeriesList,
+			newTimeSeries("tether_monitor_push_duration_seconds", duration.Seconds(), now, labels),
+			newTimeSeries("tether_monitor_push_errors_total", float64(selfMetrics.pushErrors[output]), now, labels),
+			newTimeSeries("tether_monitor_samples_sent_total", float64(selfMetrics.samplesSent[output]), now, labels),
+			newTimeSeries("tether_monitor_samples_dropped_total", float64(selfMetrics.samplesDropped[output]), now, labels),
+		)
+	}
+	for reused, count := range selfMetrics.connections {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_monitor_remote_write_connections_total", float64(count), now, []promremote.Label{
+			{Name: "reused", Value: strconv.FormatBool(reused)},
+		}))
+	}
+	for queue, depth := range selfMetrics.queueDepths {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_monitor_queue_depth", float64(depth), now, []promremote.Label{
+			{Name: "queue", Value: queue},
+		}))
+	}
+	if selfMetrics.connections[false] > 0 {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_monitor_remote_write_connect_duration_seconds", selfMetrics.connectDuration.Seconds(), now, nil))
+	}
+	return timeSeriesList
+}
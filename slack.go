@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// Attachment colors by severity, shared with the Discord embeds.
+var severityColors = map[string]string{
+	"critical": "#d32f2f",
+	"warning":  "#f9a825",
+	"info":     "#1976d2",
+	"resolved": "#388e3c",
+}
+
+// SlackNotifier posts events to a Slack incoming webhook as attachments
+// colored by severity.
+type SlackNotifier struct {
+	URL string
+}
+
+func (n SlackNotifier) Notify(event Event) error {
+	fields := []map[string]any{
+		{"title": "Interface", "value": event.Interface, "short": true},
+		{"title": "Device", "value": event.Device, "short": true},
+	}
+	payload, err := json.Marshal(map[string]any{
+		"attachments": []map[string]any{{
+			"color":    severityColors[eventSeverity(event)],
+			"fallback": event.Message,
+			"text":     event.Message,
+			"fields":   fields,
+			"ts":       event.Time.Unix(),
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	return postNotification(n.URL, "application/json", payload)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// SMSMessage is a text message stored on the modem.
+type SMSMessage struct {
+	ID     string // storage index, only unique while the message is stored
+	Sender string
+	Time   string
+	Text   string
+}
+
+// +CMGL: <index>,<status>,<sender>,<alpha>,<timestamp>
+var cmglRegex = regexp.MustCompile(`^\+CMGL:\s*(\d+),"([^"]*)","([^"]*)",[^,]*,"([^"]*)"`)
+
+// getSMSMessages lists the messages stored on the modem. Over QMI only the
+// messages not in known are fetched, since each takes a command of its own.
+func getSMSMessages(modem Modem, known map[string]bool) ([]SMSMessage, error) {
+	if modem.QMIDevice != "" {
+		output, err := executeQMICommand(modem.QMIDevice, "--list-messages")
+		if err != nil {
+			return nil, err
+		}
+		var ids []int
+		if err := json.Unmarshal(output, &ids); err != nil {
+			return nil, fmt.Errorf("Error unmarshalling uqmi message list: %w", err)
+		}
+
+		var messages []SMSMessage
+		for _, id := range ids {
+			message := SMSMessage{ID: strconv.Itoa(id)}
+			if !known[message.ID] {
+				output, err := executeQMICommand(modem.QMIDevice, "--get-message", message.ID)
+				if err != nil {
+					return nil, err
+				}
+				var stored struct {
+					Sender    string `json:"sender"`
+					Timestamp string `json:"timestamp"`
+					Text      string `json:"text"`
+				}
+				if err := json.Unmarshal(output, &stored); err != nil {
+					return nil, fmt.Errorf("Error unmarshalling uqmi message %d: %w", id, err)
+				}
+				message.Sender, message.Time, message.Text = stored.Sender, stored.Timestamp, stored.Text
+			}
+			messages = append(messages, message)
+		}
+		return messages, nil
+	}
+
+	if modem.ATPort != "" {
+		if _, err := executeATCommand(modem.ATPort, "AT+CMGF=1"); err != nil {
+			return nil, err
+		}
+		lines, err := executeATCommand(modem.ATPort, `AT+CMGL="ALL"`)
+		if err != nil {
+			return nil, err
+		}
+		return parseCMGL(lines), nil
+	}
+
+	return nil, errNoModem
+}
+
+// parseCMGL parses a text mode message listing, where each header line is
+// followed by the lines of the message text.
+func parseCMGL(lines []string) []SMSMessage {
+	var messages []SMSMessage
+	for _, line := range lines {
+		if matches := cmglRegex.FindStringSubmatch(line); len(matches) == 5 {
+			messages = append(messages, SMSMessage{ID: matches[1], Sender: matches[3], Time: matches[4]})
+			continue
+		}
+		if len(messages) == 0 {
+			continue
+		}
+		message := &messages[len(messages)-1]
+		if message.Text != "" {
+			message.Text += "\n"
+		}
+		message.Text += line
+	}
+	return messages
+}
+
+// SMSTracker remembers the messages already seen on each interface's modem,
+// so only newly received ones are counted and forwarded.
+type SMSTracker struct {
+	seen     map[string]map[string]bool
+	received map[string]int
+}
+
+var smsInbox = &SMSTracker{
+	seen:     make(map[string]map[string]bool),
+	received: make(map[string]int),
+}
+
+// collectSMS exports the number of stored messages and of messages received
+// since the monitor started. With FORWARD_SMS, new messages are sent through
+// the notifiers. Messages already stored when the monitor starts are neither
+// counted nor forwarded.
+func collectSMS(modem Modem, labels []promremote.Label, now time.Time) []promremote.TimeSeries {
+	iface := labelValue(labels, "interface")
+	device := labelValue(labels, "device")
+
+	seen, polled := smsInbox.seen[iface]
+	messages, err := getSMSMessages(modem, seen)
+	if err != nil {
+		if err != errNoModem {
+			collectorLog.Warn("Error getting SMS messages", "interface", iface, "err", err)
+		}
+		return nil
+	}
+
+	current := make(map[string]bool)
+	for _, message := range messages {
+		key := message.ID
+		if modem.QMIDevice == "" {
+			// AT storage indexes are reused once messages are deleted, so
+			// the timestamp tells a new message in the same slot apart.
+			key += "/" + message.Time
+		}
+		current[key] = true
+		if !polled || seen[key] {
+			continue
+		}
+
+		smsInbox.received[iface]++
+		if forwardSMS {
+			notify(Event{
+				Kind:      "sms",
+				Interface: iface,
+				Device:    device,
+				Message:   fmt.Sprintf("SMS from %s on %s (%s): %s", message.Sender, iface, device, strings.TrimSpace(message.Text)),
+				Time:      now,
+			})
+		}
+	}
+	smsInbox.seen[iface] = current
+
+	return []promremote.TimeSeries{
+		newTimeSeries("tether_modem_sms_messages", float64(len(messages)), now, labels),
+		newTimeSeries("tether_modem_sms_received_total", float64(smsInbox.received[iface]), now, labels),
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// SpeedtestResult is the throughput measured by one bandwidth test. Rates
+// are in bits per second.
+type SpeedtestResult struct {
+	Download float64
+	Upload   float64
+	Bytes    int64
+	Time     time.Time
+}
+
+// SpeedtestState tracks the bandwidth tests, which run in the background
+// because a single one takes longer than a collection cycle.
+type SpeedtestState struct {
+	mu sync.Mutex
+	// results keeps the last result per interface, which is exported every
+	// cycle until the next test replaces it.
+	results map[string]SpeedtestResult
+	// attempts keeps when each interface was last tested, successfully or
+	// not, so a failing test waits for the next slot instead of being
+	// retried every cycle.
+	attempts map[string]time.Time
+	running  map[string]bool
+	// unbilled is test traffic not yet charged to the interface's usage
+	// period, which only the collection cycle updates.
+	unbilled map[string]int64
+}
+
+var speedtests = &SpeedtestState{
+	results:  make(map[string]SpeedtestResult),
+	attempts: make(map[string]time.Time),
+	running:  make(map[string]bool),
+	unbilled: make(map[string]int64),
+}
+
+// due reports whether the next test of an interface is due: at the
+// first slot of SPEEDTEST_SCHEDULE after the last attempt if a schedule is
+// set, and SPEEDTEST_INTERVAL_SECONDS after it otherwise. With a schedule,
+// an interface seen for the first time waits for the next slot.
+// The caller holds s.mu.
+func (s *SpeedtestState) due(iface string, now time.Time) bool {
+	attempted, exists := s.attempts[iface]
+	if speedtestSchedule != nil {
+		if !exists {
+			s.attempts[iface] = now
+			return false
+		}
+		next := speedtestSchedule.next(attempted)
+		return !next.IsZero() && !now.Before(next)
+	}
+	return !exists || now.Sub(attempted) >= time.Duration(speedtestIntervalSeconds)*time.Second
+}
+
+// runSpeedtest measures the bandwidth of one interface with the configured
+// tool. speedtest-cli can only bind to a source address, iperf3 binds to the
+// device itself. Tests take longer than most commands, so COMMAND_TIMEOUTS
+// usually needs an entry for the tool.
+func runSpeedtest(device, sourceAddress string) (SpeedtestResult, error) {
+	result := SpeedtestResult{Time: time.Now()}
+
+	switch speedtestTool {
+	case "speedtest-cli":
+		if sourceAddress == "" {
+			return result, fmt.Errorf("no IPv4 address to bind speedtest-cli to")
+		}
+		args := []string{"--json", "--secure", "--source", sourceAddress}
+		if speedtestServer != "" {
+			args = append(args, "--server", speedtestServer)
+		}
+		output, err := executeShellCommand("speedtest-cli", args...)
+		if err != nil {
+			return result, fmt.Errorf("Error executing speedtest-cli: %w", err)
+		}
+		var report struct {
+			Download      float64 `json:"download"`
+			Upload        float64 `json:"upload"`
+			BytesSent     int64   `json:"bytes_sent"`
+			BytesReceived int64   `json:"bytes_received"`
+		}
+		if err := json.Unmarshal(output, &report); err != nil {
+			return result, fmt.Errorf("Error unmarshalling speedtest-cli output: %w", err)
+		}
+		result.Download = report.Download
+		result.Upload = report.Upload
+		result.Bytes = report.BytesSent + report.BytesReceived
+
+	case "iperf3":
+		// Upload first, then download with the server sending (-R).
+		for _, reverse := range []bool{false, true} {
+			args := []string{"-c", speedtestServer, "--bind-dev", device, "-J", "-t", "10"}
+			if reverse {
+				args = append(args, "-R")
+			}
+			output, err := executeShellCommand("iperf3", args...)
+			if err != nil {
+				return result, fmt.Errorf("Error executing iperf3: %w", err)
+			}
+			var report struct {
+				End struct {
+					SumReceived struct {
+						Bytes         int64   `json:"bytes"`
+						BitsPerSecond float64 `json:"bits_per_second"`
+					} `json:"sum_received"`
+				} `json:"end"`
+			}
+			if err := json.Unmarshal(output, &report); err != nil {
+				return result, fmt.Errorf("Error unmarshalling iperf3 output: %w", err)
+			}
+			if reverse {
+				result.Download = report.End.SumReceived.BitsPerSecond
+			} else {
+				result.Upload = report.End.SumReceived.BitsPerSecond
+			}
+			result.Bytes += report.End.SumReceived.Bytes
+		}
+	}
+	return result, nil
+}
+
+// run tests an interface and records the result. A failed test may well
+// have used data before it failed, so it is charged what the last
+// successful one used.
+func (s *SpeedtestState) run(iface, device, sourceAddress string) {
+	defer observeCollector("speedtest", time.Now())
+	result, err := runSpeedtest(device, sourceAddress)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running[iface] = false
+	if err != nil {
+		collectorLog.Error("Error running speedtest", "interface", iface, "err", err)
+		s.unbilled[iface] += s.results[iface].Bytes
+		return
+	}
+	s.results[iface] = result
+	s.unbilled[iface] += result.Bytes
+}
+
+// collectSpeedtest starts a bandwidth test in the background when one is
+// due, unless one is still running or the test traffic of the current
+// billing period would exceed SPEEDTEST_DATA_BUDGET, and exports the last
+// result.
+func collectSpeedtest(iface, device string, status InterfaceStatus, labels []promremote.Label, now time.Time) []promremote.TimeSeries {
+	speedtests.mu.Lock()
+	defer speedtests.mu.Unlock()
+
+	// Interfaces without traffic counters have no usage to budget against.
+	period := usage.counters[iface]
+	if period != nil {
+		period.SpeedtestBytes += speedtests.unbilled[iface]
+	}
+	delete(speedtests.unbilled, iface)
+	last, tested := speedtests.results[iface]
+
+	budgetExhausted := 0.0
+	if period != nil && speedtestDataBudget > 0 && period.SpeedtestBytes+last.Bytes > speedtestDataBudget {
+		budgetExhausted = 1.0
+	}
+
+	if budgetExhausted == 0 && !oneShot && !speedtests.running[iface] && speedtests.due(iface, now) {
+		speedtests.attempts[iface] = now
+		speedtests.running[iface] = true
+
+		var sourceAddress string
+		if len(status.IPv4Addrs) > 0 {
+			sourceAddress = status.IPv4Addrs[0].Address
+		}
+		go speedtests.run(iface, device, sourceAddress)
+	}
+
+	timeSeriesList := []promremote.TimeSeries{
+		newTimeSeries("tether_speedtest_budget_exhausted", budgetExhausted, now, labels),
+	}
+	if period != nil {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_speedtest_period_bytes", float64(period.SpeedtestBytes), now, labels))
+	}
+	if tested {
+		labels = append(labels, promremote.Label{Name: "tool", Value: speedtestTool})
+		timeSeriesList = append(timeSeriesList,
+			newTimeSeries("tether_speedtest_download_bits_per_second", last.Download, now, labels),
+			newTimeSeries("tether_speedtest_upload_bits_per_second", last.Upload, now, labels),
+			newTimeSeries("tether_speedtest_last_run_timestamp_seconds", float64(last.Time.Unix()), now, labels),
+		)
+	}
+	return timeSeriesList
+}
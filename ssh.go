@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// executeSSHCommand runs a command on a remote router. ssh joins its
+// arguments into a single shell command line, so each one is quoted.
+func executeSSHCommand(target, command string, args ...string) ([]byte, error) {
+	remoteCommand := shellQuote(command)
+	for _, arg := range args {
+		remoteCommand += " " + shellQuote(arg)
+	}
+
+	sshArgs := []string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=10"}
+	if sshIdentityFile != "" {
+		sshArgs = append(sshArgs, "-i", sshIdentityFile)
+	}
+	sshArgs = append(sshArgs, target, remoteCommand)
+	return executeShellCommand("ssh", sshArgs...)
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// sshTargetHost strips the user from a user@host target.
+func sshTargetHost(target string) string {
+	if _, host, found := strings.Cut(target, "@"); found {
+		return host
+	}
+	return target
+}
+
+// collectSSHTargets collects every router in SSH_TARGETS in turn. Only the
+// commands behind the base interface metrics are run remotely; collectors
+// that read the local /sys or /proc, talk to modems or act on the router
+// are skipped in this mode. Each router's series carry its host as
+// instance label.
+func collectSSHTargets() Cycle {
+	cycle := Cycle{Time: time.Now()}
+	resetCollectorDurations()
+
+	var timeSeriesList []promremote.TimeSeries
+	collected := false
+	for _, target := range sshTargets {
+		interfaces, series, err := collectSSHTarget(target)
+		if err != nil {
+			collectorLog.Error("Error collecting router over SSH", "target", target, "err", err)
+			continue
+		}
+		collected = true
+		cycle.Interfaces = append(cycle.Interfaces, interfaces...)
+		timeSeriesList = append(timeSeriesList, series...)
+	}
+	if collected {
+		health.collected(cycle.Time)
+	}
+
+	timeSeriesList = append(timeSeriesList, collectSelfMetrics(time.Now())...)
+
+	applyStaticLabels(timeSeriesList, staticLabels)
+	timeSeriesList = relabel(timeSeriesList, relabelRules)
+	alerts.evaluate(timeSeriesList, time.Now())
+
+	cycle.TimeSeries = timeSeriesList
+	collectorLog.Debug("Collection finished", "routers", len(sshTargets), "interfaces", len(cycle.Interfaces), "series", len(cycle.TimeSeries), "duration", time.Since(cycle.Time))
+	return cycle
+}
+
+func collectSSHTarget(target string) ([]CombinedData, []promremote.TimeSeries, error) {
+	defer observeCollector("ssh", time.Now())
+
+	ifdevOutput, err := executeSSHCommand(target, "ifdev")
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error executing ifdev: %w", err)
+	}
+	mwan3ifstatusOutput, err := executeSSHCommand(target, "mwan3ifstatus")
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error executing mwan3ifstatus: %w", err)
+	}
+
+	var networkTraffic map[string]NetworkTraffic
+	if trafficBackend == "ip" {
+		output, err := executeSSHCommand(target, "ip", "-j", "-s", "link")
+		if err == nil {
+			networkTraffic, err = parseIPLinkTraffic(output)
+		}
+		if err != nil {
+			collectorLog.Error("Error getting network traffic", "target", target, "err", err)
+		}
+	} else if output, err := executeSSHCommand(target, "ifconfig"); err == nil {
+		networkTraffic = parseNetworkTraffic(string(output))
+	} else {
+		collectorLog.Error("Error getting network traffic", "target", target, "err", err)
+	}
+	if counterWrap32 {
+		trafficWraps.apply(target+"/", networkTraffic)
+	}
+
+	var ifdevData []Ifdev
+	var mwan3ifstatusData []Mwan3ifstatus
+	json.Unmarshal(ifdevOutput, &ifdevData)
+	json.Unmarshal(mwan3ifstatusOutput, &mwan3ifstatusData)
+	ifdevData = filterTetherInterfaces(ifdevData)
+
+	merged := mergeData(ifdevData, mwan3ifstatusData, networkTraffic)
+	devices := make([]string, len(merged))
+	descriptions := make([]string, len(merged))
+	deviceLabels := make([]string, len(merged))
+	failed := make([]bool, len(merged))
+	for i, data := range merged {
+		devices[i] = data.Device
+		description := data.Device
+		if !matchesAnyPattern(wanInterfaces, data.Interface) {
+			output, err := executeSSHCommand(target, "ifusb", data.Device)
+			if err == nil {
+				description, err = parseUSBDescription(output)
+			}
+			if err != nil {
+				collectorLog.Error("Error getting USB device", "target", target, "interface", data.Interface, "device", data.Device, "err", err)
+				failed[i] = true
+				continue
+			}
+		}
+		descriptions[i], deviceLabels[i] = description, description
+		// USB serials can't be read remotely, so aliases match descriptions only.
+		if alias, exists := deviceAliases[description]; exists {
+			deviceLabels[i] = alias
+		}
+	}
+	// Nor can the sysfs attributes that tell identical devices apart.
+	disambiguateDeviceLabels(devices, deviceLabels, func(device string) string {
+		return device
+	})
+
+	var interfaces []CombinedData
+	var timeSeriesList []promremote.TimeSeries
+	present := make(map[string][]promremote.Label)
+	now := time.Now()
+	for i, data := range merged {
+		if failed[i] {
+			present[data.Interface] = nil
+			continue
+		}
+		device := deviceLabels[i]
+		data.Description = descriptions[i]
+		interfaces = append(interfaces, data)
+
+		labels := []promremote.Label{
+			{Name: "device", Value: device},
+			{Name: "interface", Value: data.Interface},
+			{Name: "instance", Value: sshTargetHost(target)},
+		}
+		present[data.Interface] = labels
+		timeSeriesList = append(timeSeriesList, interfaceTimeSeries(data, labels, now)...)
+		if traffic, exists := networkTraffic[data.Device]; exists {
+			timeSeriesList = append(timeSeriesList, trafficTimeSeries(traffic, labels, now)...)
+		}
+	}
+	timeSeriesList = append(timeSeriesList, interfaceStaleness.observe(target+"/", present, now)...)
+	return interfaces, timeSeriesList, nil
+}
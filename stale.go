@@ -0,0 +1,66 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// seenInterface is what was last reported for an interface.
+type seenInterface struct {
+	labels   []promremote.Label
+	lastSeen time.Time
+}
+
+// StalenessTracker remembers the interfaces reported in previous cycles so
+// the ones that vanish (unplugged phones, removed interfaces) are pushed as
+// offline once instead of leaving their last value frozen on dashboards.
+type StalenessTracker struct {
+	seen map[string]seenInterface
+}
+
+var interfaceStaleness = &StalenessTracker{
+	seen: make(map[string]seenInterface),
+}
+
+// observe records the interfaces present in this cycle and returns their
+// last-seen series plus offline markers for every interface under prefix
+// that is gone or now reported with different labels. The prefix keeps the
+// interfaces of different routers apart. Interfaces mapped to nil labels
+// are present but couldn't be labelled this cycle and are left as they were.
+func (t *StalenessTracker) observe(prefix string, present map[string][]promremote.Label, now time.Time) []promremote.TimeSeries {
+	var timeSeriesList []promremote.TimeSeries
+	for key, previous := range t.seen {
+		iface, found := strings.CutPrefix(key, prefix)
+		if !found {
+			continue
+		}
+		labels, exists := present[iface]
+		if exists && (labels == nil || slices.Equal(labels, previous.labels)) {
+			continue
+		}
+		timeSeriesList = append(timeSeriesList, staleTimeSeries(previous, now)...)
+		delete(t.seen, key)
+	}
+
+	for iface, labels := range present {
+		if labels == nil {
+			continue
+		}
+		t.seen[prefix+iface] = seenInterface{labels: labels, lastSeen: now}
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_iface_last_seen_timestamp_seconds", float64(now.Unix()), now, labels))
+	}
+	return timeSeriesList
+}
+
+// staleTimeSeries marks a vanished interface as offline and untracked and
+// reports when it was last seen.
+func staleTimeSeries(previous seenInterface, now time.Time) []promremote.TimeSeries {
+	return []promremote.TimeSeries{
+		newTimeSeries("tether_iface_status_online", 0, now, previous.labels),
+		newTimeSeries("tether_iface_status_tracking", 0, now, previous.labels),
+		newTimeSeries("tether_iface_last_seen_timestamp_seconds", float64(previous.lastSeen.Unix()), now, previous.labels),
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// statsdMaxPacket keeps datagrams below the typical Ethernet MTU.
+const statsdMaxPacket = 1400
+
+var lastStatsdTraffic = make(map[string]NetworkTraffic)
+
+// statsdMetric formats one StatsD line, either with DogStatsD tags or with the
+// interface folded into the metric name for plain StatsD servers.
+func statsdMetric(name, iface, device string, value interface{}, kind string) string {
+	if statsdTags {
+		return fmt.Sprintf("%s.iface.%s:%v|%s|#interface:%s,device:%s", statsdPrefix, name, value, kind, iface, device)
+	}
+	return fmt.Sprintf("%s.%s.%s:%v|%s", statsdPrefix, strings.ReplaceAll(iface, ".", "_"), name, value, kind)
+}
+
+// writeStatsd emits RX/TX as counter deltas since the previous cycle and the
+// interface status as gauges.
+func writeStatsd(cycle Cycle) error {
+	var lines []string
+	for _, data := range cycle.Interfaces {
+		online, enabled, tracking := 0, 0, 0
+		if data.Status == "online" {
+			online = 1
+		}
+		if data.Status != "disabled" {
+			enabled = 1
+		}
+		if data.Tracking == "active" {
+			tracking = 1
+		}
+		lines = append(lines,
+			statsdMetric("status_online", data.Interface, data.Device, online, "g"),
+			statsdMetric("status_enabled", data.Interface, data.Device, enabled, "g"),
+			statsdMetric("status_tracking", data.Interface, data.Device, tracking, "g"),
+		)
+
+		// The first sample only establishes the baseline.
+		if last, exists := lastStatsdTraffic[data.Interface]; exists {
+			lines = append(lines,
+				statsdMetric("rx", data.Interface, data.Device, counterDelta(last.RX, data.RX), "c"),
+				statsdMetric("tx", data.Interface, data.Device, counterDelta(last.TX, data.TX), "c"),
+			)
+		}
+		lastStatsdTraffic[data.Interface] = NetworkTraffic{Interface: data.Interface, RX: data.RX, TX: data.TX}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	conn, err := net.Dial("udp", statsdAddress)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+len(line)+1 > statsdMaxPacket {
+			if _, err := conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	_, err = conn.Write(packet.Bytes())
+	return err
+}
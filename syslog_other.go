@@ -0,0 +1,16 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+func parseSyslogFacility(name string) (int, error) {
+	return 0, fmt.Errorf("syslog is not supported on this platform")
+}
+
+func newSyslogHandler(facilityName, tag, format string, options *slog.HandlerOptions) (slog.Handler, error) {
+	return nil, fmt.Errorf("syslog is not supported on this platform")
+}
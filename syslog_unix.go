@@ -0,0 +1,108 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"log/syslog"
+	"strings"
+	"sync"
+)
+
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":   syslog.LOG_KERN,
+	"user":   syslog.LOG_USER,
+	"daemon": syslog.LOG_DAEMON,
+	"local0": syslog.LOG_LOCAL0,
+	"local1": syslog.LOG_LOCAL1,
+	"local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3,
+	"local4": syslog.LOG_LOCAL4,
+	"local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6,
+	"local7": syslog.LOG_LOCAL7,
+}
+
+func parseSyslogFacility(name string) (syslog.Priority, error) {
+	facility, exists := syslogFacilities[strings.ToLower(name)]
+	if !exists {
+		return 0, fmt.Errorf("unknown syslog facility %q", name)
+	}
+	return facility, nil
+}
+
+// syslogOutput is shared by a syslogHandler and all handlers derived from it
+// through WithAttrs/WithGroup.
+type syslogOutput struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	writer *syslog.Writer
+}
+
+// syslogHandler formats records with the configured text or JSON handler and
+// sends each one to the local syslog (logd on OpenWrt) at the priority
+// matching its level. syslog stamps the time itself, so the handler omits it.
+type syslogHandler struct {
+	slog.Handler
+	out *syslogOutput
+}
+
+func newSyslogHandler(facilityName, tag, format string, options *slog.HandlerOptions) (slog.Handler, error) {
+	facility, err := parseSyslogFacility(facilityName)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := syslog.New(facility|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to syslog: %w", err)
+	}
+
+	out := &syslogOutput{writer: writer}
+	formatOptions := &slog.HandlerOptions{
+		Level: options.Level,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) == 0 && attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}
+	var handler slog.Handler = slog.NewTextHandler(&out.buf, formatOptions)
+	if format == "json" {
+		handler = slog.NewJSONHandler(&out.buf, formatOptions)
+	}
+	return syslogHandler{handler, out}, nil
+}
+
+func (h syslogHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+
+	h.out.buf.Reset()
+	if err := h.Handler.Handle(ctx, record); err != nil {
+		return err
+	}
+	message := strings.TrimSuffix(h.out.buf.String(), "\n")
+
+	switch {
+	case record.Level >= slog.LevelError:
+		return h.out.writer.Err(message)
+	case record.Level >= slog.LevelWarn:
+		return h.out.writer.Warning(message)
+	case record.Level >= slog.LevelInfo:
+		return h.out.writer.Info(message)
+	default:
+		return h.out.writer.Debug(message)
+	}
+}
+
+func (h syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return syslogHandler{h.Handler.WithAttrs(attrs), h.out}
+}
+
+func (h syslogHandler) WithGroup(name string) slog.Handler {
+	return syslogHandler{h.Handler.WithGroup(name), h.out}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+const (
+	procLoadavg = "/proc/loadavg"
+	procMeminfo = "/proc/meminfo"
+	procStat    = "/proc/stat"
+	procUptime  = "/proc/uptime"
+	// USER_HZ is 100 on every architecture OpenWrt runs on.
+	userHZ = 100
+)
+
+// cpuModes are the columns of the "cpu" line in /proc/stat, in order.
+var cpuModes = []string{"user", "nice", "system", "idle", "iowait", "irq", "softirq", "steal"}
+
+// meminfoFields maps the /proc/meminfo fields worth exporting to metric names.
+var meminfoFields = map[string]string{
+	"MemTotal":     "tether_router_memory_total_bytes",
+	"MemFree":      "tether_router_memory_free_bytes",
+	"MemAvailable": "tether_router_memory_available_bytes",
+	"Buffers":      "tether_router_memory_buffers_bytes",
+	"Cached":       "tether_router_memory_cached_bytes",
+}
+
+func readLoadAverage() ([]float64, error) {
+	data, err := os.ReadFile(procLoadavg)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(data))
+	var loads []float64
+	for i := 0; i < 3 && i < len(fields); i++ {
+		load, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil, err
+		}
+		loads = append(loads, load)
+	}
+	return loads, nil
+}
+
+// readMeminfo returns the /proc/meminfo values in bytes.
+func readMeminfo() (map[string]int64, error) {
+	file, err := os.Open(procMeminfo)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]int64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// MemTotal:         125628 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) == 3 && fields[2] == "kB" {
+			value *= 1024
+		}
+		values[strings.TrimSuffix(fields[0], ":")] = value
+	}
+	return values, scanner.Err()
+}
+
+// readCPUSeconds returns the seconds all CPUs spent in each mode since boot.
+func readCPUSeconds() (map[string]float64, error) {
+	file, err := os.Open(procStat)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	seconds := make(map[string]float64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "cpu" {
+			continue
+		}
+		for i, mode := range cpuModes {
+			if i+1 >= len(fields) {
+				break
+			}
+			ticks, _ := strconv.ParseFloat(fields[i+1], 64)
+			seconds[mode] = ticks / userHZ
+		}
+		break
+	}
+	return seconds, scanner.Err()
+}
+
+func readUptime() (float64, error) {
+	data, err := os.ReadFile(procUptime)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty %s", procUptime)
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// readBootTime returns the btime line of /proc/stat. Unlike now minus
+// uptime it doesn't jitter between samples.
+func readBootTime() (int64, error) {
+	file, err := os.Open(procStat)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "btime" {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no btime in %s", procStat)
+}
+
+// collectBootTime exports when the router booted, so a reboot can be told
+// apart from an interface that merely flapped.
+func collectBootTime(now time.Time) []promremote.TimeSeries {
+	var timeSeriesList []promremote.TimeSeries
+
+	if uptime, err := readUptime(); err == nil {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_router_uptime_seconds", uptime, now, nil))
+	} else {
+		collectorLog.Error("Error reading uptime", "err", err)
+	}
+
+	if bootTime, err := readBootTime(); err == nil {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_router_boot_time_seconds", float64(bootTime), now, nil))
+	} else {
+		collectorLog.Error("Error reading boot time", "err", err)
+	}
+
+	return timeSeriesList
+}
+
+func collectSystemResources(now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("system", time.Now())
+
+	var timeSeriesList []promremote.TimeSeries
+	ok := true
+
+	if loads, err := readLoadAverage(); err == nil {
+		for i, name := range []string{"tether_router_load1", "tether_router_load5", "tether_router_load15"} {
+			if i < len(loads) {
+				timeSeriesList = append(timeSeriesList, newTimeSeries(name, loads[i], now, nil))
+			}
+		}
+	} else {
+		collectorLog.Error("Error reading load average", "err", err)
+		ok = false
+	}
+
+	if meminfo, err := readMeminfo(); err == nil {
+		for field, name := range meminfoFields {
+			if value, exists := meminfo[field]; exists {
+				timeSeriesList = append(timeSeriesList, newTimeSeries(name, float64(value), now, nil))
+			}
+		}
+	} else {
+		collectorLog.Error("Error reading meminfo", "err", err)
+		ok = false
+	}
+
+	if cpuSeconds, err := readCPUSeconds(); err == nil {
+		for mode, value := range cpuSeconds {
+			timeSeriesList = append(timeSeriesList, newTimeSeries("tether_router_cpu_seconds_total", value, now, []promremote.Label{
+				{Name: "mode", Value: mode},
+			}))
+		}
+	} else {
+		collectorLog.Error("Error reading CPU statistics", "err", err)
+		ok = false
+	}
+
+	return timeSeriesList, ok
+}
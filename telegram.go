@@ -0,0 +1,25 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+const telegramAPIURL = "https://api.telegram.org"
+
+// TelegramNotifier sends events as messages to a Telegram chat through a bot.
+type TelegramNotifier struct {
+	Token  string
+	ChatID string
+}
+
+func (n TelegramNotifier) Notify(event Event) error {
+	payload, err := json.Marshal(map[string]string{
+		"chat_id": n.ChatID,
+		"text":    event.Message,
+	})
+	if err != nil {
+		return err
+	}
+	// postNotification keeps the token in the path out of its errors.
+	return postNotification(telegramAPIURL+"/bot"+n.Token+"/sendMessage", "application/json", payload)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+const sysClassThermal = "/sys/class/thermal"
+
+// ThermalZone is a kernel thermal zone, usually the SoC or a WiFi radio.
+type ThermalZone struct {
+	Zone        string
+	Type        string
+	Temperature float64
+}
+
+func getThermalZones() ([]ThermalZone, error) {
+	paths, err := filepath.Glob(filepath.Join(sysClassThermal, "thermal_zone*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var zones []ThermalZone
+	for _, path := range paths {
+		// Zones of sensors that are powered down fail to read; skip them.
+		milliCelsius, err := readIntFile(filepath.Join(path, "temp"))
+		if err != nil {
+			continue
+		}
+		zoneType, _ := os.ReadFile(filepath.Join(path, "type"))
+		zones = append(zones, ThermalZone{
+			Zone:        filepath.Base(path),
+			Type:        strings.TrimSpace(string(zoneType)),
+			Temperature: float64(milliCelsius) / 1000,
+		})
+	}
+	return zones, nil
+}
+
+func collectThermalZones(now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("thermal", time.Now())
+
+	zones, err := getThermalZones()
+	if err != nil {
+		collectorLog.Error("Error reading thermal zones", "err", err)
+		return nil, false
+	}
+
+	var timeSeriesList []promremote.TimeSeries
+	for _, zone := range zones {
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_router_temperature_celsius", zone.Temperature, now, []promremote.Label{
+			{Name: "zone", Value: zone.Zone},
+			{Name: "type", Value: zone.Type},
+		}))
+	}
+	return timeSeriesList, true
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNetworkTraffic(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   map[string]NetworkTraffic
+	}{
+		{
+			name: "busybox",
+			output: `usb0      Link encap:Ethernet  HWaddr 02:00:00:00:00:01
+          inet addr:192.168.42.2  Bcast:192.168.42.255  Mask:255.255.255.0
+          UP BROADCAST RUNNING MULTICAST  MTU:1500  Metric:1
+          RX packets:1000 errors:1 dropped:2 overruns:0 frame:0
+          TX packets:500 errors:3 dropped:4 overruns:0 carrier:0
+          collisions:0 txqueuelen:1000
+          RX bytes:123456 (120.5 KiB)  TX bytes:65432 (63.8 KiB)
+`,
+			want: map[string]NetworkTraffic{
+				"usb0": {Interface: "usb0", RX: 123456, TX: 65432, RXPackets: 1000, TXPackets: 500, RXErrors: 1, TXErrors: 3, RXDropped: 2, TXDropped: 4},
+			},
+		},
+		{
+			name: "net-tools",
+			output: `usb1: flags=4163<UP,BROADCAST,RUNNING,MULTICAST>  mtu 1500
+        inet 172.20.10.2  netmask 255.255.255.240  broadcast 172.20.10.15
+        ether 02:00:00:00:00:02  txqueuelen 1000  (Ethernet)
+        RX packets 2000  bytes 987654 (964.5 KiB)
+        RX errors 5  dropped 6  overruns 0  frame 0
+        TX packets 1500  bytes 456789 (446.0 KiB)
+        TX errors 7  dropped 8 overruns 0  carrier 0  collisions 0
+`,
+			want: map[string]NetworkTraffic{
+				"usb1": {Interface: "usb1", RX: 987654, TX: 456789, RXPackets: 2000, TXPackets: 1500, RXErrors: 5, TXErrors: 7, RXDropped: 6, TXDropped: 8},
+			},
+		},
+		{
+			name: "block without counters is skipped",
+			output: `usb0      Link encap:Ethernet  HWaddr 02:00:00:00:00:01
+          RX packets:10 errors:0 dropped:0 overruns:0 frame:0
+          TX packets:20 errors:0 dropped:0 overruns:0 carrier:0
+          RX bytes:100 (100.0 B)  TX bytes:200 (200.0 B)
+
+tun0: flags=4305<UP,POINTOPOINT,RUNNING,NOARP,MULTICAST>  mtu 1500
+        unspec 00-00-00-00-00-00-00-00-00-00-00-00-00-00-00-00  txqueuelen 500  (UNSPEC)
+`,
+			want: map[string]NetworkTraffic{
+				"usb0": {Interface: "usb0", RX: 100, TX: 200, RXPackets: 10, TXPackets: 20},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseNetworkTraffic(test.output); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseNetworkTraffic() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
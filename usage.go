@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UsageCounter accumulates the traffic of one interface within a billing period.
+type UsageCounter struct {
+	PeriodStart       time.Time `json:"period_start"`
+	RX                int64     `json:"rx"`
+	TX                int64     `json:"tx"`
+	LastRX            int64     `json:"last_rx"`
+	LastTX            int64     `json:"last_tx"`
+	NotifiedThreshold float64   `json:"notified_threshold"`
+	SpeedtestBytes    int64     `json:"speedtest_bytes"` // traffic caused by bandwidth tests
+}
+
+// UsageTracker keeps per-interface usage counters, optionally persisted to a
+// state file so a restart of the monitor doesn't lose the current period.
+// Routers keep state on flash, so the file is only written every
+// USAGE_SAVE_INTERVAL_SECONDS, when a billing period rolls over and on
+// shutdown; a crash loses at most one interval of traffic.
+type UsageTracker struct {
+	path       string
+	counters   map[string]*UsageCounter
+	savedAt    time.Time
+	rolledOver bool
+}
+
+func newUsageTracker(path string) *UsageTracker {
+	tracker := &UsageTracker{
+		path:     path,
+		counters: make(map[string]*UsageCounter),
+	}
+	if path == "" {
+		return tracker
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			collectorLog.Error("Error reading usage state", "path", path, "err", err)
+		}
+		return tracker
+	}
+	if err := json.Unmarshal(data, &tracker.counters); err != nil {
+		collectorLog.Error("Error unmarshalling usage state", "path", path, "err", err)
+	}
+	return tracker
+}
+
+// billingPeriodStart returns the start of the billing period containing now
+// for a period that resets on resetDay of each month. Days past the end of a
+// short month reset on its last day.
+func billingPeriodStart(now time.Time, resetDay int) time.Time {
+	if resetDay < 1 {
+		resetDay = 1
+	}
+
+	periodStart := func(year int, month time.Month) time.Time {
+		day := resetDay
+		if lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, now.Location()).Day(); day > lastDay {
+			day = lastDay
+		}
+		return time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+	}
+
+	start := periodStart(now.Year(), now.Month())
+	if now.Before(start) {
+		start = periodStart(now.Year(), now.Month()-1)
+	}
+	return start
+}
+
+// update adds the traffic seen since the previous sample to the interface's
+// current period. Counter resets (reboots, re-plugged devices) are treated as
+// starting from zero.
+func (u *UsageTracker) update(iface string, rx, tx int64, now time.Time) *UsageCounter {
+	periodStart := billingPeriodStart(now, billingResetDays[iface])
+
+	counter, exists := u.counters[iface]
+	if !exists {
+		counter = &UsageCounter{PeriodStart: periodStart, LastRX: rx, LastTX: tx}
+		u.counters[iface] = counter
+		return counter
+	}
+
+	if !counter.PeriodStart.Equal(periodStart) {
+		u.rolledOver = true
+		counter.PeriodStart = periodStart
+		counter.RX = 0
+		counter.TX = 0
+		counter.NotifiedThreshold = 0
+		counter.SpeedtestBytes = 0
+	}
+
+	counter.RX += counterDelta(counter.LastRX, rx)
+	counter.TX += counterDelta(counter.LastTX, tx)
+	counter.LastRX = rx
+	counter.LastTX = tx
+	return counter
+}
+
+// dataCapFor returns the data cap of an interface. Caps can be keyed by
+// interface or by device label, so a cap follows a phone across ports.
+func dataCapFor(iface, device string) int64 {
+	if dataCap, exists := dataCaps[iface]; exists {
+		return dataCap
+	}
+	return dataCaps[device]
+}
+
+// checkDataCap notifies once per billing period for each of the
+// DATA_CAP_THRESHOLDS percentages of the data cap an interface reaches.
+// Crossing several thresholds within one interval notifies only the highest.
+func checkDataCap(iface, device string, counter *UsageCounter, now time.Time) {
+	dataCap := dataCapFor(iface, device)
+	if dataCap <= 0 {
+		return
+	}
+
+	percent := float64(counter.RX+counter.TX) / float64(dataCap) * 100
+	reached := 0.0
+	for _, threshold := range dataCapThresholds {
+		if percent >= threshold {
+			reached = threshold
+		}
+	}
+	if reached <= counter.NotifiedThreshold {
+		return
+	}
+	counter.NotifiedThreshold = reached
+
+	message := fmt.Sprintf("%s (%s) used %g%% of its data cap of %d bytes this billing period", iface, device, reached, dataCap)
+	if reached == 100 {
+		message = fmt.Sprintf("%s (%s) used its data cap of %d bytes this billing period", iface, device, dataCap)
+	}
+	notify(Event{
+		Kind:      "data_cap",
+		Interface: iface,
+		Device:    device,
+		Message:   message,
+		Time:      now,
+	})
+}
+
+func counterDelta(previous, current int64) int64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+// maybeSave saves the counters if the save interval passed since the last
+// save or a billing period rolled over. The first call always saves, which
+// keeps the state of single cycles run from cron.
+func (u *UsageTracker) maybeSave(now time.Time) error {
+	if !u.rolledOver && now.Sub(u.savedAt) < time.Duration(usageSaveIntervalSeconds)*time.Second {
+		return nil
+	}
+	return u.save()
+}
+
+func (u *UsageTracker) save() error {
+	if u.path == "" {
+		return nil
+	}
+	u.savedAt = time.Now()
+	u.rolledOver = false
+
+	data, err := json.Marshal(u.counters)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated state.
+	tmpPath := u.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, u.path)
+}
+
+// parseByteSize parses sizes such as "500M" or "50G" using decimal
+// multiples, as carriers count data allowances, or binary ones when given
+// explicitly as "500Mi" or "50GiB".
+func parseByteSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	value = strings.TrimSuffix(value, "B")
+
+	base := int64(1000)
+	if strings.HasSuffix(value, "I") {
+		base = 1024
+		value = strings.TrimSuffix(value, "I")
+	}
+
+	multiplier := int64(1)
+	if value != "" {
+		switch value[len(value)-1] {
+		case 'K':
+			multiplier = base
+		case 'M':
+			multiplier = base * base
+		case 'G':
+			multiplier = base * base * base
+		case 'T':
+			multiplier = base * base * base * base
+		}
+		if multiplier > 1 {
+			value = value[:len(value)-1]
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(number * float64(multiplier)), nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// usbDevicePath returns the sysfs directory of the USB device a network
+// interface belongs to, e.g. /sys/devices/platform/.../usb1/1-1.
+func usbDevicePath(device string) (string, error) {
+	path, err := filepath.EvalSymlinks("/sys/class/net/" + device + "/device")
+	if err != nil {
+		return "", fmt.Errorf("Error resolving sysfs device for %s: %w", device, err)
+	}
+
+	// The interface directory hangs off the device; walk up like ifusb does.
+	for path != "/" && path != "." {
+		if _, err := os.Stat(filepath.Join(path, "busnum")); err == nil {
+			if _, err := os.Stat(filepath.Join(path, "devnum")); err == nil {
+				return path, nil
+			}
+		}
+		path = filepath.Dir(path)
+	}
+	return "", fmt.Errorf("%s is not a USB device", device)
+}
+
+// usbSerial returns the serial number the USB device of an interface reports.
+func usbSerial(device string) (string, error) {
+	path, err := usbDevicePath(device)
+	if err != nil {
+		return "", err
+	}
+	serial, err := os.ReadFile(filepath.Join(path, "serial"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(serial)), nil
+}
+
+// USBIdentity is what the USB device of an interface reports about itself.
+// Unlike ifusb descriptions, which are often just "Android", it tells
+// otherwise identical phones apart.
+type USBIdentity struct {
+	VendorID     string
+	ProductID    string
+	Serial       string
+	Manufacturer string
+	Product      string
+	Port         string
+}
+
+// getUSBIdentity reads the identity attributes from sysfs. Devices without
+// a serial or string descriptors leave those fields empty.
+func getUSBIdentity(device string) (USBIdentity, error) {
+	path, err := usbDevicePath(device)
+	if err != nil {
+		return USBIdentity{}, err
+	}
+	attribute := func(name string) string {
+		value, _ := os.ReadFile(filepath.Join(path, name))
+		return strings.TrimSpace(string(value))
+	}
+	return USBIdentity{
+		VendorID:     attribute("idVendor"),
+		ProductID:    attribute("idProduct"),
+		Serial:       attribute("serial"),
+		Manufacturer: attribute("manufacturer"),
+		Product:      attribute("product"),
+		Port:         filepath.Base(path),
+	}, nil
+}
+
+func collectUSBIdentity(device string, labels []promremote.Label, now time.Time) []promremote.TimeSeries {
+	identity, err := getUSBIdentity(device)
+	if err != nil {
+		collectorLog.Warn("Error reading USB identity", "device", device, "err", err)
+		return nil
+	}
+	return []promremote.TimeSeries{
+		newTimeSeries("tether_usb_device_info", 1, now, append(labels,
+			promremote.Label{Name: "vendor_id", Value: identity.VendorID},
+			promremote.Label{Name: "product_id", Value: identity.ProductID},
+			promremote.Label{Name: "serial", Value: identity.Serial},
+			promremote.Label{Name: "manufacturer", Value: identity.Manufacturer},
+			promremote.Label{Name: "product", Value: identity.Product},
+			promremote.Label{Name: "usb_port", Value: identity.Port},
+		)),
+	}
+}
+
+// usbPortPath returns the physical bus and port path of the USB device of an
+// interface, such as "1-1.4". It stays the same across re-enumerations as
+// long as the device is plugged into the same port.
+func usbPortPath(device string) (string, error) {
+	path, err := usbDevicePath(device)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(path), nil
+}
+
+// deviceLabel returns the configured alias of a tether device, looked up by
+// USB serial, port path and ifusb description in that order. Without an
+// alias the description is used, or the port path when DEVICE_LABEL_SOURCE
+// is port.
+func deviceLabel(device, description string) string {
+	port, portErr := usbPortPath(device)
+	if len(deviceAliases) > 0 {
+		if serial, err := usbSerial(device); err == nil {
+			if alias, exists := deviceAliases[serial]; exists {
+				return alias
+			}
+		}
+		if alias, exists := deviceAliases[port]; exists && portErr == nil {
+			return alias
+		}
+		if alias, exists := deviceAliases[description]; exists {
+			return alias
+		}
+	}
+	if deviceLabelSource == "port" && portErr == nil {
+		return port
+	}
+	return description
+}
+
+// deviceDisambiguator returns what tells a device apart from others of the
+// same model: its USB serial, its port path or, for devices that report
+// neither, the MAC address of its interface.
+func deviceDisambiguator(device string) string {
+	if serial, err := usbSerial(device); err == nil && serial != "" {
+		return serial
+	}
+	if port, err := usbPortPath(device); err == nil {
+		return port
+	}
+	address, err := os.ReadFile("/sys/class/net/" + device + "/address")
+	if err == nil {
+		return strings.TrimSpace(string(address))
+	}
+	return device
+}
+
+// disambiguateDeviceLabels appends a disambiguator to the labels that more
+// than one device shares, such as two phones of the same model, so their
+// series don't merge into one device. devices and labels are parallel;
+// empty labels are skipped.
+func disambiguateDeviceLabels(devices, labels []string, disambiguator func(device string) string) {
+	count := make(map[string]int)
+	for _, label := range labels {
+		count[label]++
+	}
+	for i, label := range labels {
+		if label != "" && count[label] > 1 {
+			labels[i] = fmt.Sprintf("%s (%s)", label, disambiguator(devices[i]))
+		}
+	}
+}
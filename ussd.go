@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// The network answers USSD requests asynchronously and often slowly.
+const ussdTimeout = 30 * time.Second
+
+// +CUSD: <m>[,<str>,<dcs>]
+var cusdRegex = regexp.MustCompile(`^\+CUSD:\s*(\d+)(?:,"([^"]*)"(?:,(\d+))?)?`)
+
+// queryUSSD sends a USSD code such as *123# and returns the network's reply.
+// uqmi can't send USSD, so this needs the modem's AT port.
+func queryUSSD(modem Modem, code string) (string, error) {
+	if modem.ATPort == "" {
+		return "", errNoModem
+	}
+
+	// Ask for plain text replies; modems that don't support it answer in UCS2.
+	executeATCommand(modem.ATPort, `AT+CSCS="GSM"`)
+
+	lines, err := executeATCommandUntil(modem.ATPort, fmt.Sprintf(`AT+CUSD=1,"%s",15`, code), "+CUSD:", ussdTimeout)
+	if err != nil {
+		return "", err
+	}
+	matches := cusdRegex.FindStringSubmatch(lines[len(lines)-1])
+	if matches == nil {
+		return "", fmt.Errorf("unexpected USSD reply: %q", lines[len(lines)-1])
+	}
+	// 0 and 1 carry a reply, everything else means the request failed.
+	if matches[1] != "0" && matches[1] != "1" {
+		return "", fmt.Errorf("USSD request %s failed with status %s", code, matches[1])
+	}
+	if matches[1] == "1" {
+		// Leave the menu the network opened so the next request starts fresh.
+		executeATCommand(modem.ATPort, "AT+CUSD=2")
+	}
+	return decodeUSSD(matches[2], matches[3]), nil
+}
+
+// decodeUSSD decodes replies sent with the UCS2 data coding scheme, which
+// arrive as hex-encoded UTF-16.
+func decodeUSSD(reply, dcs string) string {
+	if dcs != "72" {
+		return reply
+	}
+	raw, err := hex.DecodeString(reply)
+	if err != nil || len(raw)%2 != 0 {
+		return reply
+	}
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		units[i] = uint16(raw[2*i])<<8 | uint16(raw[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+// parseUSSDBalance extracts the balance from a reply using the first
+// capture group of USSD_BALANCE_REGEX. Decimal commas are accepted.
+func parseUSSDBalance(reply string) (float64, error) {
+	matches := regexp.MustCompile(ussdBalancePattern).FindStringSubmatch(reply)
+	if len(matches) < 2 {
+		return 0, fmt.Errorf("no balance in USSD reply: %q", reply)
+	}
+	return strconv.ParseFloat(strings.ReplaceAll(matches[1], ",", "."), 64)
+}
+
+// USSDBalance is the last balance read for an interface's SIM.
+type USSDBalance struct {
+	Value     float64
+	Time      time.Time // of the last successful query
+	Attempted time.Time
+}
+
+var ussdBalances = make(map[string]USSDBalance)
+
+// collectUSSDBalance queries the interface's USSD_QUERIES code at most once
+// every USSD_INTERVAL_SECONDS, since carriers throttle or even charge for
+// frequent requests, and exports the last balance every cycle.
+func collectUSSDBalance(modem Modem, labels []promremote.Label, now time.Time) []promremote.TimeSeries {
+	iface := labelValue(labels, "interface")
+	code := ussdQueries[iface]
+
+	balance := ussdBalances[iface]
+	if now.Sub(balance.Attempted) >= time.Duration(ussdIntervalSeconds)*time.Second {
+		defer observeCollector("ussd", time.Now())
+		balance.Attempted = now
+
+		reply, err := queryUSSD(modem, code)
+		if err == nil {
+			collectorLog.Debug("USSD reply", "interface", iface, "code", code, "reply", reply)
+			var value float64
+			if value, err = parseUSSDBalance(reply); err == nil {
+				balance.Value, balance.Time = value, now
+			}
+		}
+		if err != nil {
+			collectorLog.Warn("Error querying USSD balance", "interface", iface, "code", code, "err", err)
+		}
+		ussdBalances[iface] = balance
+	}
+	if balance.Time.IsZero() {
+		return nil
+	}
+
+	labels = append(labels, promremote.Label{Name: "code", Value: code})
+	return []promremote.TimeSeries{
+		newTimeSeries("tether_modem_ussd_balance", balance.Value, now, labels),
+		newTimeSeries("tether_modem_ussd_last_success_timestamp_seconds", float64(balance.Time.Unix()), now, labels),
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// WireGuardPeer is a peer line of `wg show all dump`.
+type WireGuardPeer struct {
+	Tunnel        string
+	PublicKey     string
+	Endpoint      string
+	LastHandshake time.Time
+	RX            int64
+	TX            int64
+}
+
+func getWireGuardPeers() ([]WireGuardPeer, error) {
+	output, err := executeShellCommand("wg", "show", "all", "dump")
+	if err != nil {
+		return nil, fmt.Errorf("Error executing wg: %w", err)
+	}
+	return parseWireGuardDump(string(output)), nil
+}
+
+// parseWireGuardDump parses the tab-separated dump. Interface lines have 5
+// fields and are skipped; peer lines have 9:
+// interface public-key preshared-key endpoint allowed-ips latest-handshake rx tx keepalive
+func parseWireGuardDump(output string) []WireGuardPeer {
+	var peers []WireGuardPeer
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 9 {
+			continue
+		}
+		handshake, _ := strconv.ParseInt(fields[5], 10, 64)
+		rx, _ := strconv.ParseInt(fields[6], 10, 64)
+		tx, _ := strconv.ParseInt(fields[7], 10, 64)
+		peer := WireGuardPeer{
+			Tunnel:    fields[0],
+			PublicKey: fields[1],
+			Endpoint:  fields[3],
+			RX:        rx,
+			TX:        tx,
+		}
+		if handshake > 0 {
+			peer.LastHandshake = time.Unix(handshake, 0)
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// OpenVPNStatus holds the byte counters of an OpenVPN client status file
+// (status-version 1).
+type OpenVPNStatus struct {
+	Name    string
+	Updated time.Time
+	RX      int64
+	TX      int64
+}
+
+func readOpenVPNStatus(path string) (OpenVPNStatus, error) {
+	status := OpenVPNStatus{Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return status, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ",")
+		if !found {
+			continue
+		}
+		switch key {
+		case "Updated":
+			status.Updated, _ = time.ParseInLocation("Mon Jan _2 15:04:05 2006", value, time.Local)
+		case "TCP/UDP read bytes":
+			status.RX, _ = strconv.ParseInt(value, 10, 64)
+		case "TCP/UDP write bytes":
+			status.TX, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	return status, scanner.Err()
+}
+
+func collectWireGuard(now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("wireguard", time.Now())
+
+	peers, err := getWireGuardPeers()
+	if err != nil {
+		collectorLog.Error("Error getting WireGuard peers", "err", err)
+		return nil, false
+	}
+
+	var timeSeriesList []promremote.TimeSeries
+	for _, peer := range peers {
+		labels := []promremote.Label{
+			{Name: "tunnel", Value: peer.Tunnel},
+			{Name: "peer", Value: peer.PublicKey},
+			{Name: "endpoint", Value: peer.Endpoint},
+		}
+		timeSeriesList = append(timeSeriesList,
+			newTimeSeries("tether_wireguard_peer_bytes", float64(peer.RX), now, append(labels, promremote.Label{Name: "direction", Value: "rx"})),
+			newTimeSeries("tether_wireguard_peer_bytes", float64(peer.TX), now, append(labels, promremote.Label{Name: "direction", Value: "tx"})),
+		)
+		// A peer that never completed a handshake has no age to report.
+		if !peer.LastHandshake.IsZero() {
+			timeSeriesList = append(timeSeriesList,
+				newTimeSeries("tether_wireguard_peer_handshake_age_seconds", now.Sub(peer.LastHandshake).Seconds(), now, labels))
+		}
+	}
+	return timeSeriesList, true
+}
+
+func collectOpenVPN(now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("openvpn", time.Now())
+
+	var timeSeriesList []promremote.TimeSeries
+	ok := true
+	for _, path := range openVPNStatusFiles {
+		status, err := readOpenVPNStatus(path)
+		if err != nil {
+			collectorLog.Error("Error reading OpenVPN status", "path", path, "err", err)
+			ok = false
+			continue
+		}
+		labels := []promremote.Label{{Name: "tunnel", Value: status.Name}}
+		timeSeriesList = append(timeSeriesList,
+			newTimeSeries("tether_openvpn_bytes", float64(status.RX), now, append(labels, promremote.Label{Name: "direction", Value: "rx"})),
+			newTimeSeries("tether_openvpn_bytes", float64(status.TX), now, append(labels, promremote.Label{Name: "direction", Value: "tx"})),
+		)
+		if !status.Updated.IsZero() {
+			timeSeriesList = append(timeSeriesList,
+				newTimeSeries("tether_openvpn_status_age_seconds", now.Sub(status.Updated).Seconds(), now, labels))
+		}
+	}
+	return timeSeriesList, ok
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// AddressTracker remembers the last WAN address seen per interface and
+// address family and counts how often it changed.
+type AddressTracker struct {
+	last    map[string]string
+	changes map[string]int
+}
+
+var wanAddresses = &AddressTracker{
+	last:    make(map[string]string),
+	changes: make(map[string]int),
+}
+
+// observe records the current address and returns the number of changes so
+// far. Losing an address doesn't count as a change; only a different address
+// coming back does.
+func (t *AddressTracker) observe(iface, family, address string) int {
+	key := iface + "/" + family
+	if address != "" {
+		if last, exists := t.last[key]; exists && last != address {
+			t.changes[key]++
+		}
+		t.last[key] = address
+	}
+	return t.changes[key]
+}
+
+func collectWANAddresses(iface string, status InterfaceStatus, labels []promremote.Label, now time.Time) []promremote.TimeSeries {
+	var ipv4, ipv6 string
+	if len(status.IPv4Addrs) > 0 {
+		ipv4 = status.IPv4Addrs[0].Address
+	}
+	if len(status.IPv6Addrs) > 0 {
+		ipv6 = status.IPv6Addrs[0].Address
+	}
+
+	return []promremote.TimeSeries{
+		newTimeSeries("tether_iface_info", 1, now, append(labels,
+			promremote.Label{Name: "ipv4", Value: ipv4},
+			promremote.Label{Name: "ipv6", Value: ipv6},
+			promremote.Label{Name: "gateway", Value: defaultGateway(status)},
+			promremote.Label{Name: "proto", Value: status.Proto},
+		)),
+		newTimeSeries("tether_iface_ip_changes_total", float64(wanAddresses.observe(iface, "ipv4", ipv4)), now, append(labels,
+			promremote.Label{Name: "family", Value: "ipv4"},
+		)),
+		newTimeSeries("tether_iface_ip_changes_total", float64(wanAddresses.observe(iface, "ipv6", ipv6)), now, append(labels,
+			promremote.Label{Name: "family", Value: "ipv6"},
+		)),
+	}
+}
+
+// defaultGateway returns the next hop of the interface's IPv4 default route,
+// or of its IPv6 one if it has no IPv4 default route.
+func defaultGateway(status InterfaceStatus) string {
+	var gateway string
+	for _, route := range status.Routes {
+		if route.Mask != 0 {
+			continue
+		}
+		if route.Target == "0.0.0.0" {
+			return route.Nexthop
+		}
+		if route.Target == "::" && gateway == "" {
+			gateway = route.Nexthop
+		}
+	}
+	return gateway
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/m3db/prometheus_remote_client_golang/promremote"
+)
+
+// WifiStation is an associated client as reported by rpcd's iwinfo module.
+type WifiStation struct {
+	MAC    string `json:"mac"`
+	Signal int    `json:"signal"`
+}
+
+// ubusCall runs a ubus method and unmarshals its JSON reply into result.
+func ubusCall(result interface{}, object, method string, args interface{}) error {
+	command := []string{"call", object, method}
+	if args != nil {
+		message, err := json.Marshal(args)
+		if err != nil {
+			return err
+		}
+		command = append(command, string(message))
+	}
+
+	output, err := executeShellCommand("ubus", command...)
+	if err != nil {
+		return fmt.Errorf("Error executing ubus call %s %s: %w", object, method, err)
+	}
+	if err := json.Unmarshal(output, result); err != nil {
+		return fmt.Errorf("Error unmarshalling ubus call %s %s: %w", object, method, err)
+	}
+	return nil
+}
+
+func getWifiDevices() ([]string, error) {
+	var reply struct {
+		Devices []string `json:"devices"`
+	}
+	err := ubusCall(&reply, "iwinfo", "devices", nil)
+	return reply.Devices, err
+}
+
+func getWifiSSID(device string) (string, error) {
+	var reply struct {
+		SSID string `json:"ssid"`
+	}
+	err := ubusCall(&reply, "iwinfo", "info", map[string]string{"device": device})
+	return reply.SSID, err
+}
+
+func getWifiStations(device string) ([]WifiStation, error) {
+	var reply struct {
+		Results []WifiStation `json:"results"`
+	}
+	err := ubusCall(&reply, "iwinfo", "assoclist", map[string]string{"device": device})
+	return reply.Results, err
+}
+
+func collectWifi(now time.Time) ([]promremote.TimeSeries, bool) {
+	defer observeCollector("wifi", time.Now())
+
+	devices, err := getWifiDevices()
+	if err != nil {
+		collectorLog.Error("Error getting wireless devices", "err", err)
+		return nil, false
+	}
+
+	var timeSeriesList []promremote.TimeSeries
+	ok := true
+	for _, device := range devices {
+		stations, err := getWifiStations(device)
+		if err != nil {
+			collectorLog.Error("Error getting associated stations", "wifi_device", device, "err", err)
+			ok = false
+			continue
+		}
+		ssid, err := getWifiSSID(device)
+		if err != nil {
+			collectorLog.Warn("Error getting SSID", "wifi_device", device, "err", err)
+			ok = false
+		}
+
+		labels := []promremote.Label{
+			{Name: "wifi_device", Value: device},
+			{Name: "ssid", Value: ssid},
+		}
+		timeSeriesList = append(timeSeriesList, newTimeSeries("tether_wifi_stations", float64(len(stations)), now, labels))
+
+		if !collectWifiStationSignal {
+			continue
+		}
+		for _, station := range stations {
+			timeSeriesList = append(timeSeriesList, newTimeSeries("tether_wifi_station_signal_dbm", float64(station.Signal), now,
+				append(labels, promremote.Label{Name: "mac", Value: station.MAC})))
+		}
+	}
+	return timeSeriesList, ok
+}